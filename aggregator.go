@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mattr/gator/internal/database"
+	"os"
+	"sync"
+	"time"
+)
+
+// errLeaseLost is returned when the lease on a feed expired while it was being fetched and
+// the feed was leased to another worker, so the fetch cannot be recorded.
+var errLeaseLost = errors.New("lease on the feed expired while it was being fetched")
+
+const (
+	// shutdownGrace is how long the feeds being fetched are given to finish when the
+	// aggregator is stopped, before they are cancelled.
+	shutdownGrace = 30 * time.Second
+	// defaultLeaseDuration is how long a feed is leased to a worker when none is configured.
+	defaultLeaseDuration = 10 * time.Minute
+)
+
+// aggregator fetches due feeds with a pool of workers, so that many feeds can be fetched
+// at once while bounding the number of requests in flight. Feeds are leased to the
+// aggregator before they are fetched, so that several aggregators (on different machines)
+// can share a database without fetching the same feed.
+type aggregator struct {
+	s       *state
+	workers int
+	jobs    chan database.Feed
+	// id identifies the aggregator in leases, and with the number of the worker, in the
+	// feeds it fetches.
+	id    string
+	lease time.Duration
+
+	mu   sync.Mutex
+	busy int
+	// fetched, failed and stored count the feeds fetched, the fetches that failed and the
+	// new or changed posts stored, for the summary when the aggregator stops.
+	fetched int
+	failed  int
+	stored  int
+}
+
+// newAggregator returns an aggregator with the given number of workers, identified by the
+// host name and process id. The scheduling config is checked up front, as feeds could not be
+// scheduled after being fetched if it was invalid.
+func newAggregator(s *state, workers int) (*aggregator, error) {
+	lease, err := parseDurationOr(s.config.LeaseDuration, defaultLeaseDuration, "lease_duration")
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = fetchIntervalBounds(s)
+	if err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return &aggregator{
+		s:       s,
+		workers: workers,
+		jobs:    make(chan database.Feed),
+		id:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+		lease:   lease,
+	}, nil
+}
+
+// run starts the workers, then every interval hands each idle worker a due feed to fetch.
+// An error fetching a feed is reported without stopping the other workers.
+//
+// When ctx is cancelled no more feeds are handed out, and the feeds being fetched are
+// given shutdownGrace to finish before they are cancelled too. A summary of the work done
+// is printed before returning.
+func (a *aggregator) run(ctx context.Context, interval time.Duration) error {
+	start := time.Now()
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	var wg sync.WaitGroup
+	for n := range a.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.work(workCtx, fmt.Sprintf("%s/%d", a.id, n+1))
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		err := a.dispatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			fmt.Println("Error finding feeds to fetch:", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	close(a.jobs)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	a.mu.Lock()
+	busy := a.busy
+	a.mu.Unlock()
+	if busy > 0 {
+		fmt.Printf("Stopping, waiting up to %s for %d feeds being fetched\n", shutdownGrace, busy)
+	}
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+		cancelWork()
+		<-done
+	}
+
+	fmt.Printf("Fetched %d feeds (%d failed) and stored %d new or changed posts in %s\n",
+		a.fetched, a.failed, a.stored, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// dispatch leases due feeds to the idle workers. A feed stays leased until it has been
+// fetched and scheduled, or the lease expires.
+func (a *aggregator) dispatch(ctx context.Context) error {
+	a.mu.Lock()
+	idle := a.workers - a.busy
+	a.mu.Unlock()
+	if idle == 0 {
+		return nil
+	}
+
+	feeds, err := a.s.db.ClaimDueFeeds(ctx, database.ClaimDueFeedsParams{
+		Limit:        int32(idle),
+		Worker:       nullString(a.id),
+		LeaseSeconds: int32(a.lease / time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	if len(feeds) == 0 {
+		fmt.Println("No feeds are due to be fetched")
+		return nil
+	}
+
+	for _, feed := range feeds {
+		a.mu.Lock()
+		a.busy++
+		a.mu.Unlock()
+		a.jobs <- feed
+	}
+	return nil
+}
+
+// work fetches the feeds it is handed until the jobs channel is closed. The lease on a
+// feed whose fetch is cancelled is released, so that another aggregator can fetch it.
+func (a *aggregator) work(ctx context.Context, worker string) {
+	for feed := range a.jobs {
+		stored, err := scrapeFeed(ctx, a.s, feed, worker)
+		if err != nil {
+			fmt.Printf("Error fetching %s: %v\n", feed.Name, err)
+		}
+		if ctx.Err() != nil {
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			err := a.s.db.ReleaseFeedLease(releaseCtx, database.ReleaseFeedLeaseParams{
+				ID:     feed.ID,
+				Worker: nullString(a.id),
+			})
+			cancel()
+			if err != nil {
+				fmt.Printf("Error releasing lease on %s: %v\n", feed.Name, err)
+			}
+		}
+		a.mu.Lock()
+		a.busy--
+		a.fetched++
+		if err != nil {
+			a.failed++
+		}
+		a.stored += stored
+		a.mu.Unlock()
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import "strings"
+
+type AtomFeed struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Link     []AtomLink  `xml:"link"`
+	Entry    []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID        string         `xml:"id"`
+	Title     string         `xml:"title"`
+	Link      []AtomLink     `xml:"link"`
+	Updated   string         `xml:"updated"`
+	Published string         `xml:"published"`
+	Summary   AtomText       `xml:"summary"`
+	Content   AtomText       `xml:"content"`
+	Category  []AtomCategory `xml:"category"`
+	Author    []AtomPerson   `xml:"author"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// AtomText is an Atom text construct. Plain text and (escaped) html content is held in
+// the character data, while xhtml content is held as inline markup.
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// String returns the content of the text construct, preserving the markup for xhtml content.
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.InnerXML)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// alternateLink returns the href of the first alternate link in the list. Links without
+// a rel attribute are alternate links by definition. Falls back to the first link if
+// there are no alternates.
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// toRSSFeed normalizes an Atom feed into an RSSFeed so that it can be stored in the same
+// way as an RSS feed.
+func (a *AtomFeed) toRSSFeed() *RSSFeed {
+	feed := &RSSFeed{}
+	feed.Channel.Title = a.Title
+	feed.Channel.Link = alternateLink(a.Link)
+	feed.Channel.Description = a.Subtitle
+	for _, entry := range a.Entry {
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+		description := entry.Summary.String()
+		content := entry.Content.String()
+		if description == "" {
+			description = content
+		}
+		var authors []string
+		for _, author := range entry.Author {
+			if author.Name != "" {
+				authors = append(authors, author.Name)
+			} else if author.Email != "" {
+				authors = append(authors, author.Email)
+			}
+		}
+		var enclosures []RSSEnclosure
+		for _, link := range entry.Link {
+			if link.Rel == "enclosure" {
+				enclosures = append(enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+			}
+		}
+		var categories []string
+		for _, category := range entry.Category {
+			if category.Term != "" {
+				categories = append(categories, category.Term)
+			} else {
+				categories = append(categories, category.Label)
+			}
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:        entry.ID,
+			Title:       entry.Title,
+			Link:        alternateLink(entry.Link),
+			Description: description,
+			PubDate:     pubDate,
+			Category:    categories,
+			Author:      strings.Join(authors, ", "),
+			Content:     content,
+			Enclosure:   enclosures,
+		})
+	}
+	return feed
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryAfter returns how long the server asks to wait before trying again, from the
+// Retry-After header given either as a number of seconds or as an HTTP date. Returns 0 if
+// the header is missing or invalid.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// freshness returns how long a response remains fresh according to its Cache-Control
+// max-age (less its Age) or, failing that, its Expires header. Returns 0 if the response
+// must not be cached or gives no lifetime.
+func freshness(header http.Header, now time.Time) time.Duration {
+	maxAge := -1
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil {
+				return 0
+			}
+			maxAge = seconds
+		}
+	}
+	if maxAge >= 0 {
+		age, _ := strconv.Atoi(header.Get("Age"))
+		return max(time.Duration(maxAge-age)*time.Second, 0)
+	}
+
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		// an invalid date, often "0", means the response has already expired
+		return 0
+	}
+	// measure from the server's own clock where possible
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		now = date
+	}
+	return max(expires.Sub(now), 0)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 30 ", 30 * time.Second},
+		{"-5", 0},
+		{"Tue, 10 Jun 2003 04:05:00 GMT", 5 * time.Minute},
+		{"Tue, 10 Jun 2003 03:55:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		if test.value != "" {
+			header.Set("Retry-After", test.value)
+		}
+		if got := retryAfter(header, now); got != test.want {
+			t.Errorf("retryAfter(%q) = %s; want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{"no headers", nil, 0},
+		{"max-age", map[string]string{"Cache-Control": "max-age=600"}, 10 * time.Minute},
+		{"quoted max-age", map[string]string{"Cache-Control": `public, max-age="600"`}, 10 * time.Minute},
+		{"max-age less age", map[string]string{"Cache-Control": "max-age=600", "Age": "120"}, 8 * time.Minute},
+		{"age beyond max-age", map[string]string{"Cache-Control": "max-age=600", "Age": "900"}, 0},
+		{"invalid max-age", map[string]string{"Cache-Control": "max-age=soon"}, 0},
+		{"no-cache before max-age", map[string]string{"Cache-Control": "no-cache, max-age=600"}, 0},
+		{"no-cache after max-age", map[string]string{"Cache-Control": "max-age=600, no-cache"}, 0},
+		{"no-store after max-age", map[string]string{"Cache-Control": "public, max-age=600, NO-STORE"}, 0},
+		{"max-age over expires", map[string]string{
+			"Cache-Control": "max-age=600",
+			"Expires":       "Tue, 10 Jun 2003 05:00:00 GMT",
+		}, 10 * time.Minute},
+		{"expires against date", map[string]string{
+			"Date":    "Tue, 10 Jun 2003 03:00:00 GMT",
+			"Expires": "Tue, 10 Jun 2003 03:30:00 GMT",
+		}, 30 * time.Minute},
+		{"expires against now", map[string]string{"Expires": "Tue, 10 Jun 2003 04:30:00 GMT"}, 30 * time.Minute},
+		{"expired", map[string]string{"Expires": "Tue, 10 Jun 2003 03:30:00 GMT"}, 0},
+		{"invalid expires", map[string]string{"Expires": "0"}, 0},
+		{"no-cache over expires", map[string]string{
+			"Cache-Control": "no-cache",
+			"Expires":       "Tue, 10 Jun 2003 04:30:00 GMT",
+		}, 0},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		for name, value := range test.header {
+			header.Set(name, value)
+		}
+		if got := freshness(header, now); got != test.want {
+			t.Errorf("freshness with %s = %s; want %s", test.name, got, test.want)
+		}
+	}
+}
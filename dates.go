@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dateLayouts lists the layouts tried, in order, when parsing a publication date. RSS
+// mandates RFC 822 dates, Atom and JSON feeds use RFC 3339, and the rest are forms
+// that are commonly seen in the wild. Named timezones and full month names are
+// normalized before parsing, so they are not listed.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC3339Nano,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"Mon Jan 2 15:04:05 -0700 2006",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05.999999999-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+	"Mon, 2 Jan 2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+}
+
+// timezoneOffsets maps the named timezones permitted by RFC 822, plus other common
+// abbreviations, to their offset from UTC in seconds. Go only resolves abbreviations
+// that match the local timezone, so they are substituted with numeric offsets first.
+// Dates with any other abbreviation are not parsed, rather than being given the wrong
+// time.
+var timezoneOffsets = map[string]int{
+	"UT":   0,
+	"UTC":  0,
+	"GMT":  0,
+	"Z":    0,
+	"EST":  -5 * 60 * 60,
+	"EDT":  -4 * 60 * 60,
+	"CST":  -6 * 60 * 60,
+	"CDT":  -5 * 60 * 60,
+	"MST":  -7 * 60 * 60,
+	"MDT":  -6 * 60 * 60,
+	"PST":  -8 * 60 * 60,
+	"PDT":  -7 * 60 * 60,
+	"AKST": -9 * 60 * 60,
+	"AKDT": -8 * 60 * 60,
+	"HST":  -10 * 60 * 60,
+	"BST":  1 * 60 * 60,
+	"IST":  int(5.5 * 60 * 60),
+	"CET":  1 * 60 * 60,
+	"CEST": 2 * 60 * 60,
+	"EET":  2 * 60 * 60,
+	"EEST": 3 * 60 * 60,
+	"JST":  9 * 60 * 60,
+	"KST":  9 * 60 * 60,
+	"AEST": 10 * 60 * 60,
+	"AEDT": 11 * 60 * 60,
+	"NZST": 12 * 60 * 60,
+	"NZDT": 13 * 60 * 60,
+}
+
+var (
+	// timezoneName matches a timezone abbreviation, optionally in brackets, following the
+	// time, either at the end or followed by the year as in "Tue Jun 10 04:00:00 EST 2003".
+	timezoneName = regexp.MustCompile(`\d:\d\d(?::\d\d(?:\.\d+)?)?(\s+\(?([A-Za-z]{1,5})\)?)(?:\s+\d{4})?$`)
+	// offsetComment matches a comment following a numeric timezone, e.g. "-0500 (EST)".
+	offsetComment = regexp.MustCompile(`([+-]\d\d:?\d\d)\s*\([^)]*\)$`)
+	// monthName matches a month name, which is shortened to its abbreviation.
+	monthName = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\b`)
+	// ordinalSuffix matches day ordinals such as "1st" or "22nd".
+	ordinalSuffix = regexp.MustCompile(`\b(\d{1,2})(st|nd|rd|th)\b`)
+	// whitespace matches runs of whitespace.
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// parseDate parses a feed publication date in any of the formats in dateLayouts. Named
+// timezones are converted to offsets, and common malformations (ordinal days, full day
+// and month names, missing commas, repeated whitespace) are tidied up before parsing.
+// Returns false if the date could not be parsed.
+func parseDate(value string) (time.Time, bool) {
+	value = normalizeDate(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// normalizeDate tidies up a date string so that it can be parsed by one of the dateLayouts.
+func normalizeDate(value string) string {
+	value = whitespace.ReplaceAllString(strings.TrimSpace(value), " ")
+	value = ordinalSuffix.ReplaceAllString(value, "$1")
+
+	// Full or unpunctuated day names, e.g. "Tuesday, 1 Jan" or "Tue 1 Jan"
+	if comma := strings.Index(value, ","); comma > 3 {
+		if _, err := time.Parse("Monday", value[:comma]); err == nil {
+			value = value[:3] + value[comma:]
+		}
+	} else if len(value) > 4 && value[3] == ' ' {
+		if _, err := time.Parse("Mon", value[:3]); err == nil && value[4] >= '0' && value[4] <= '9' {
+			value = value[:3] + "," + value[3:]
+		}
+	}
+
+	// Full month names, e.g. "10 June 2003"
+	value = monthName.ReplaceAllString(value, "$1")
+
+	// Named timezones, e.g. "EST" or "(PDT)", or comments following a numeric timezone
+	value = offsetComment.ReplaceAllString(value, "$1")
+	if match := timezoneName.FindStringSubmatchIndex(value); match != nil {
+		offset, ok := timezoneOffsets[strings.ToUpper(value[match[4]:match[5]])]
+		if !ok {
+			return ""
+		}
+		value = value[:match[2]] + " " + formatOffset(offset) + value[match[3]:]
+	}
+	return value
+}
+
+// publishedAt returns the publication date of the item, from the pubDate element or
+// the dc:date element if there is no pubDate. Returns an invalid NullTime if neither
+// can be parsed.
+func (item RSSItem) publishedAt() sql.NullTime {
+	for _, value := range []string{item.PubDate, item.DCDate} {
+		if t, ok := parseDate(value); ok {
+			return sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return sql.NullTime{}
+}
+
+// formatOffset formats an offset from UTC in seconds as a numeric timezone, e.g. -0500.
+func formatOffset(offset int) string {
+	return time.Unix(0, 0).In(time.FixedZone("", offset)).Format("-0700")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	est := time.FixedZone("", -5*60*60)
+	utc := time.UTC
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		// RFC 1123 and RFC 822
+		{"Tue, 10 Jun 2003 04:00:00 -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 10 Jun 2003 04:00:00 GMT", time.Date(2003, 6, 10, 4, 0, 0, 0, utc), true},
+		{"Tue, 10 Jun 03 04:00:00 -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 10 Jun 2003 04:00 EST", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"10 Jun 2003 04:00:00 -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 3 Jun 2003 04:00:00 +0000", time.Date(2003, 6, 3, 4, 0, 0, 0, utc), true},
+
+		// named timezones and comments
+		{"Tue, 10 Jun 2003 04:00:00 EST", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 10 Jun 2003 01:00:00 PDT", time.Date(2003, 6, 10, 8, 0, 0, 0, utc), true},
+		{"Tue, 10 Jun 2003 04:00:00 (EST)", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 10 Jun 2003 04:00:00 -0500 (EST)", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 10 Jun 2003 04:00:00 -0500 (Eastern Standard Time)", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue Jun 10 04:00:00 EST 2003", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue, 10 Jun 2003 04:00:00 MSK", time.Time{}, false},
+		{"Tue, 10 Jun 2003 04:00:00 WIB", time.Time{}, false},
+
+		// ISO 8601
+		{"2003-06-10T04:00:00Z", time.Date(2003, 6, 10, 4, 0, 0, 0, utc), true},
+		{"2003-06-10T04:00:00.123-05:00", time.Date(2003, 6, 10, 4, 0, 0, 123000000, est), true},
+		{"2003-06-10T04:00:00-0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"2003-06-10T04:00", time.Date(2003, 6, 10, 4, 0, 0, 0, utc), true},
+		{"2003-06-10 04:00:00 +02:00", time.Date(2003, 6, 10, 2, 0, 0, 0, utc), true},
+		{"2003-06-10 04:00:00 -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"2003-06-10 04:00:00", time.Date(2003, 6, 10, 4, 0, 0, 0, utc), true},
+		{"2003-06-10", time.Date(2003, 6, 10, 0, 0, 0, 0, utc), true},
+
+		// malformed
+		{"Tuesday, 10 June 2003", time.Date(2003, 6, 10, 0, 0, 0, 0, utc), true},
+		{"Tuesday, 10 Jun 2003 04:00:00 -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"Tue 10 Jun 2003 04:00:00 -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"10 June 2003", time.Date(2003, 6, 10, 0, 0, 0, 0, utc), true},
+		{"June 10th, 2003", time.Date(2003, 6, 10, 0, 0, 0, 0, utc), true},
+		{"Tue,  10 Jun  2003 04:00:00   -0500", time.Date(2003, 6, 10, 4, 0, 0, 0, est), true},
+		{"", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseDate(test.value)
+		if ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("parseDate(%q) = %v, %v; want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a diff.
+const diffContext = 2
+
+// diffOp is a single line of a diff: an unchanged (' '), removed ('-') or added ('+') line.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the line-by-line differences between a and b, computed from their
+// longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// formatDiff formats the differences between a and b, showing only the changed lines and
+// the diffContext lines around them. Returns an empty string if a and b are the same.
+func formatDiff(a, b string) string {
+	ops := diffLines(strings.Split(a, "\n"), strings.Split(b, "\n"))
+
+	// show each line within diffContext lines of a change
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for j := max(0, i-diffContext); j <= min(len(ops)-1, i+diffContext); j++ {
+			show[j] = true
+		}
+	}
+
+	var builder strings.Builder
+	for i, op := range ops {
+		if !show[i] {
+			continue
+		}
+		if i > 0 && !show[i-1] {
+			builder.WriteString("...\n")
+		}
+		builder.WriteString(strings.TrimRight(fmt.Sprintf("%c %s", op.kind, op.line), " ") + "\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/net/html"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// feedCandidate is a feed advertised by (or found alongside) an HTML page.
+type feedCandidate struct {
+	Title string
+	URL   string
+}
+
+// feedLinkTypes are the media types of <link rel="alternate"> elements that point to feeds.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are paths that are tried when a page does not advertise any feeds.
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss",
+	"/feed.xml",
+	"/rss.xml",
+	"/atom.xml",
+	"/index.xml",
+	"/feed.json",
+}
+
+// discoverFeeds returns the feeds available at pageURL. If pageURL is itself a feed,
+// it is the only candidate returned. If it is an HTML page, the feeds advertised in
+// its <link rel="alternate"> elements are returned, or failing that, any feeds found
+// at the commonFeedPaths of the site.
+func discoverFeeds(ctx context.Context, client *httpClient, pageURL string) ([]feedCandidate, error) {
+	data, contentType, err := fetchDocument(ctx, client, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if feed, err := parseFeed(data, contentType); err == nil {
+		return []feedCandidate{{Title: feed.Channel.Title, URL: pageURL}}, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("%s is neither a feed nor an HTML page (%s)", pageURL, contentType)
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	candidates := feedLinks(data, base)
+	if len(candidates) > 0 {
+		return candidates, nil
+	}
+
+	for _, path := range commonFeedPaths {
+		candidateURL := base.ResolveReference(&url.URL{Path: path}).String()
+		data, contentType, err := fetchDocument(ctx, client, candidateURL)
+		if err != nil {
+			continue
+		}
+		if feed, err := parseFeed(data, contentType); err == nil {
+			candidates = append(candidates, feedCandidate{Title: feed.Channel.Title, URL: candidateURL})
+		}
+	}
+	return candidates, nil
+}
+
+// feedLinks returns the feeds advertised by <link rel="alternate"> elements in the HTML
+// document, with relative URLs resolved against base (or the document's <base href>).
+func feedLinks(data []byte, base *url.URL) []feedCandidate {
+	var candidates []feedCandidate
+	seen := make(map[string]bool)
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return candidates
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+		token := tokenizer.Token()
+		switch token.Data {
+		case "base":
+			if href, err := url.Parse(attr(token, "href")); err == nil {
+				base = base.ResolveReference(href)
+			}
+		case "link":
+			if !hasToken(attr(token, "rel"), "alternate") {
+				continue
+			}
+			mediaType, _, _ := mime.ParseMediaType(attr(token, "type"))
+			if !feedLinkTypes[mediaType] {
+				continue
+			}
+			href, err := url.Parse(strings.TrimSpace(attr(token, "href")))
+			if err != nil {
+				continue
+			}
+			link := base.ResolveReference(href).String()
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+			candidates = append(candidates, feedCandidate{Title: attr(token, "title"), URL: link})
+		}
+	}
+}
+
+// fetchDocument fetches the document at the URL, returning the body and its content type.
+func fetchDocument(ctx context.Context, client *httpClient, documentURL string) ([]byte, string, error) {
+	request, err := client.newRequest(ctx, documentURL)
+	if err != nil {
+		return nil, "", err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, "", &statusError{StatusCode: response.StatusCode}
+	}
+	data, err := client.readBody(response)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, response.Header.Get("Content-Type"), nil
+}
+
+// attr returns the value of the named attribute of the token, or an empty string.
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether the space-separated list contains the token, ignoring case.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
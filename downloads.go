@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mattr/gator/internal/database"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultDownloadTemplate is the filename template used when none is configured.
+const defaultDownloadTemplate = "{{.Feed}}/{{.Date}} {{.Title}}{{.Ext}}"
+
+// downloadName holds the values available to the download filename template.
+type downloadName struct {
+	Feed  string
+	Title string
+	Date  string
+	Ext   string
+}
+
+// downloadDir returns the configured download directory, or gator/downloads in the
+// user's home directory if none is configured.
+func downloadDir(s *state) (string, error) {
+	if s.config.DownloadDir != "" {
+		return s.config.DownloadDir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, "gator", "downloads"), nil
+}
+
+// downloadPath returns the path in dir to download the enclosure to, using the configured
+// filename template. The feed name and post title are sanitized so that they cannot
+// introduce additional directories, and the path must remain inside dir. If another
+// download (or any other file) already has the path, such as an episode with the same
+// title and date, the start of the enclosure id is added to the file name.
+func downloadPath(ctx context.Context, s *state, dir string, pending database.GetPendingDownloadsRow) (string, error) {
+	text := s.config.DownloadTemplate
+	if text == "" {
+		text = defaultDownloadTemplate
+	}
+	tmpl, err := template.New("download").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid download template: %w", err)
+	}
+
+	date := "undated"
+	if pending.PublishedAt.Valid {
+		date = pending.PublishedAt.Time.Format("2006-01-02")
+	}
+	name := downloadName{
+		Feed:  sanitizeFilename(pending.FeedName),
+		Title: sanitizeFilename(pending.PostTitle),
+		Date:  date,
+		Ext:   enclosureExtension(pending.Url, pending.MimeType.String),
+	}
+	var builder strings.Builder
+	err = tmpl.Execute(&builder, name)
+	if err != nil {
+		return "", err
+	}
+
+	downloadPath := filepath.Join(dir, builder.String())
+	relative, err := filepath.Rel(dir, downloadPath)
+	if err != nil || relative == "." || strings.HasPrefix(relative, "..") {
+		return "", fmt.Errorf("download template produced a path outside %s", dir)
+	}
+
+	inUse, err := s.db.DownloadPathInUse(ctx, downloadPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(downloadPath); inUse || err == nil {
+		suffix := fmt.Sprintf(" (%s)", pending.ID.String()[:8])
+		downloadPath = strings.TrimSuffix(downloadPath, name.Ext) + suffix + name.Ext
+	}
+	return downloadPath, nil
+}
+
+// sanitizeFilename replaces characters that are not safe in file names.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 32, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "untitled"
+	}
+	return name
+}
+
+// enclosureExtension returns the file extension for the enclosure, taken from its URL
+// or failing that, its MIME type.
+func enclosureExtension(enclosureURL, mimeType string) string {
+	if parsed, err := url.Parse(enclosureURL); err == nil {
+		if ext := path.Ext(parsed.Path); ext != "" && len(ext) <= 6 {
+			return ext
+		}
+	}
+	if extensions, err := mime.ExtensionsByType(mimeType); err == nil && len(extensions) > 0 {
+		return extensions[0]
+	}
+	return ""
+}
+
+// downloadFile downloads the file at fileURL to filePath, returning its size. The file
+// is first downloaded to filePath with a .part suffix; if a partial download already
+// exists, it is resumed with an HTTP range request.
+func downloadFile(ctx context.Context, client *httpClient, fileURL, filePath string) (int64, error) {
+	err := os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return 0, err
+	}
+	partPath := filePath + ".part"
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	// episodes can take longer to download than the time allowed for a feed, and are
+	// larger than the maximum response size, so neither limit applies
+	request, err := client.newRequest(withoutTimeout(ctx), fileURL)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0:
+		flags |= os.O_APPEND
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the partial download is already complete
+		return offset, os.Rename(partPath, filePath)
+	case response.StatusCode == http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+	default:
+		return 0, &statusError{StatusCode: response.StatusCode}
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(file, response.Body)
+	closeErr := file.Close()
+	if err = errors.Join(err, closeErr); err != nil {
+		return 0, err
+	}
+	return offset + written, os.Rename(partPath, filePath)
+}
+
+// removeExpiredDownloads deletes the downloaded files that are no longer among the most
+// recent episodes of feeds with a keep policy. The downloads are kept in the database
+// so that they are not downloaded again.
+func removeExpiredDownloads(ctx context.Context, s *state) error {
+	expired, err := s.db.GetExpiredDownloads(ctx)
+	if err != nil {
+		return err
+	}
+	for _, download := range expired {
+		err = os.Remove(download.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		err = s.db.MarkDownloadDeleted(ctx, download.ID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", download.Path)
+	}
+	return nil
+}
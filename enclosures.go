@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mattr/gator/internal/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// enclosureParams returns the parameters to store the enclosures of the item against
+// the post, combining the <enclosure> and media:content elements of the item with its
+// iTunes episode metadata.
+func (item RSSItem) enclosureParams(postID uuid.UUID) []database.CreateEnclosureParams {
+	episode := parseNullInt32(item.ITunesEpisode)
+	season := parseNullInt32(item.ITunesSeason)
+	image := nullString(item.ITunesImage.Href)
+	duration := parseDuration(item.ITunesDuration)
+
+	var params []database.CreateEnclosureParams
+	seen := make(map[string]bool)
+	add := func(url, mimeType, length string, duration sql.NullInt32) {
+		url = strings.TrimSpace(url)
+		if url == "" || seen[url] {
+			return
+		}
+		seen[url] = true
+		size, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+		params = append(params, database.CreateEnclosureParams{
+			ID:              uuid.New(),
+			PostID:          postID,
+			Url:             url,
+			MimeType:        nullString(mimeType),
+			Length:          sql.NullInt64{Int64: size, Valid: err == nil && size > 0},
+			DurationSeconds: duration,
+			Episode:         episode,
+			Season:          season,
+			ImageUrl:        image,
+		})
+	}
+
+	for _, enclosure := range item.Enclosure {
+		add(enclosure.URL, enclosure.Type, enclosure.Length, duration)
+	}
+	for _, content := range item.MediaContent {
+		contentDuration := parseDuration(content.Duration)
+		if !contentDuration.Valid {
+			contentDuration = duration
+		}
+		add(content.URL, content.Type, content.FileSize, contentDuration)
+	}
+	return params
+}
+
+// parseDuration parses an itunes:duration, which is either a number of seconds or a
+// time in the form HH:MM:SS or MM:SS, into a number of seconds.
+func parseDuration(value string) sql.NullInt32 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return sql.NullInt32{}
+	}
+	seconds := 0.0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return sql.NullInt32{}
+		}
+		seconds = seconds*60 + n
+	}
+	return sql.NullInt32{Int32: int32(seconds), Valid: true}
+}
+
+// parseNullInt32 parses an integer, returning an invalid NullInt32 if it cannot be parsed.
+func parseNullInt32(value string) sql.NullInt32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+	if err != nil {
+		return sql.NullInt32{}
+	}
+	return sql.NullInt32{Int32: int32(n), Valid: true}
+}
+
+// nullString returns a NullString which is valid if the trimmed value is not empty.
+func nullString(value string) sql.NullString {
+	value = strings.TrimSpace(value)
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// formatEnclosure describes an enclosure for display, e.g.
+// "https://example.com/ep1.mp3 (audio/mpeg, 24.1 MB, 1h2m3s, S2E5)".
+func formatEnclosure(enclosure database.Enclosure) string {
+	var details []string
+	if enclosure.MimeType.Valid {
+		details = append(details, enclosure.MimeType.String)
+	}
+	if enclosure.Length.Valid {
+		details = append(details, fmt.Sprintf("%.1f MB", float64(enclosure.Length.Int64)/1e6))
+	}
+	if enclosure.DurationSeconds.Valid {
+		details = append(details, (time.Duration(enclosure.DurationSeconds.Int32) * time.Second).String())
+	}
+	switch {
+	case enclosure.Season.Valid && enclosure.Episode.Valid:
+		details = append(details, fmt.Sprintf("S%dE%d", enclosure.Season.Int32, enclosure.Episode.Int32))
+	case enclosure.Episode.Valid:
+		details = append(details, fmt.Sprintf("episode %d", enclosure.Episode.Int32))
+	}
+	if len(details) == 0 {
+		return enclosure.Url
+	}
+	return fmt.Sprintf("%s (%s)", enclosure.Url, strings.Join(details, ", "))
+}
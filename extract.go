@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/mattr/gator/internal/database"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// minArticleLength is the length of text below which an extracted article is assumed to
+// be a failed extraction rather than the article.
+const minArticleLength = 250
+
+var (
+	// unlikelyCandidates matches the class or id of elements that are unlikely to be part
+	// of the article, such as navigation, comments and adverts.
+	unlikelyCandidates = regexp.MustCompile(`(?i)-ad-|\bads?\b|advert|banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|header|legends|menu|modal|nav|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tweet|twitter|widget`)
+	// maybeCandidates matches the class or id of elements that may be part of the article,
+	// even if they also match unlikelyCandidates.
+	maybeCandidates = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	// positiveWeight matches the class or id of elements that are likely to contain the article.
+	positiveWeight = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|story|text|blog`)
+	// negativeWeight matches the class or id of elements that are unlikely to contain the article.
+	negativeWeight = regexp.MustCompile(`(?i)hidden|-ad-|\bads?\b|banner|byline|combx|comment|contact|footer|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removedElements are the elements that never contain article content.
+var removedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true, atom.Form: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Header: true, atom.Button: true,
+	atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Svg: true, atom.Object: true,
+	atom.Embed: true, atom.Link: true, atom.Meta: true,
+}
+
+// scoredElements are the elements whose text is scored, adding to the score of the
+// elements that contain them.
+var scoredElements = map[atom.Atom]bool{
+	atom.P: true, atom.Pre: true, atom.Td: true, atom.Blockquote: true, atom.Li: true, atom.H2: true, atom.H3: true,
+}
+
+// fetchArticle downloads the page at articleURL and extracts the main content of it.
+func fetchArticle(ctx context.Context, client *httpClient, articleURL string) (string, error) {
+	data, contentType, err := fetchDocument(ctx, client, articleURL)
+	if err != nil {
+		return "", err
+	}
+	reader, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return "", err
+	}
+	return extractArticle(doc)
+}
+
+// extractArticle finds the main content of an HTML document, readability style: elements
+// that are unlikely to be part of the article are removed, then each paragraph adds a
+// score, based on the amount of text in it, to its parent and grandparent. The element
+// with the highest score (adjusted for the density of links in it) is taken to be the
+// article, along with any siblings that score nearly as well. Returns the article as HTML.
+func extractArticle(doc *html.Node) (string, error) {
+	removeUnlikely(doc)
+
+	scores := make(map[*html.Node]float64)
+	var score func(*html.Node)
+	score = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			score(child)
+		}
+		if node.Type != html.ElementNode || !scoredElements[node.DataAtom] || node.Parent == nil {
+			return
+		}
+		text := nodeText(node)
+		if utf8.RuneCountInString(text) < 25 {
+			return
+		}
+		points := 1 + float64(strings.Count(text, ",")) + math.Min(float64(utf8.RuneCountInString(text))/100, 3)
+		parent := node.Parent
+		if _, ok := scores[parent]; !ok {
+			scores[parent] = initialScore(parent)
+		}
+		scores[parent] += points
+		if grandparent := parent.Parent; grandparent != nil && grandparent.Type == html.ElementNode {
+			if _, ok := scores[grandparent]; !ok {
+				scores[grandparent] = initialScore(grandparent)
+			}
+			scores[grandparent] += points / 2
+		}
+	}
+	score(doc)
+
+	var top *html.Node
+	for node, s := range scores {
+		scores[node] = s * (1 - linkDensity(node))
+		if top == nil || scores[node] > scores[top] {
+			top = node
+		}
+	}
+	if top == nil {
+		return "", errors.New("no article content found")
+	}
+
+	// include siblings of the top candidate that are likely to be part of the same article
+	threshold := math.Max(10, scores[top]*0.2)
+	var article bytes.Buffer
+	for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		include := sibling == top
+		if !include && sibling.Type == html.ElementNode {
+			if s, ok := scores[sibling]; ok && s >= threshold {
+				include = true
+			} else if sibling.DataAtom == atom.P {
+				text := nodeText(sibling)
+				density := linkDensity(sibling)
+				length := utf8.RuneCountInString(text)
+				include = (length > 80 && density < 0.25) || (length > 0 && density == 0 && strings.Contains(text, ". "))
+			}
+		}
+		if include {
+			removeLinkLists(sibling)
+			if err := html.Render(&article, sibling); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if utf8.RuneCountInString(htmlToText(article.String())) < minArticleLength {
+		return "", errors.New("no article content found")
+	}
+	return article.String(), nil
+}
+
+// removeUnlikely removes the elements that are unlikely to be part of the article.
+func removeUnlikely(node *html.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.CommentNode || (child.Type == html.ElementNode && isUnlikely(child)) {
+			node.RemoveChild(child)
+		} else {
+			removeUnlikely(child)
+		}
+		child = next
+	}
+}
+
+// isUnlikely reports whether the element is unlikely to be part of the article.
+func isUnlikely(node *html.Node) bool {
+	if removedElements[node.DataAtom] {
+		return true
+	}
+	if node.DataAtom == atom.Body || node.DataAtom == atom.Article || node.DataAtom == atom.Main {
+		return false
+	}
+	match := attribute(node, "class") + " " + attribute(node, "id")
+	return unlikelyCandidates.MatchString(match) && !maybeCandidates.MatchString(match)
+}
+
+// removeLinkLists removes lists and divs within the node that are mostly links, such as
+// lists of related articles.
+func removeLinkLists(node *html.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode &&
+			(child.DataAtom == atom.Ul || child.DataAtom == atom.Ol || child.DataAtom == atom.Div) &&
+			linkDensity(child) > 0.5 {
+			node.RemoveChild(child)
+		} else {
+			removeLinkLists(child)
+		}
+		child = next
+	}
+}
+
+// initialScore returns the starting score of a candidate element, based on its type and
+// its class and id.
+func initialScore(node *html.Node) float64 {
+	score := 0.0
+	switch node.DataAtom {
+	case atom.Article, atom.Main:
+		score += 10
+	case atom.Div:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+	match := attribute(node, "class") + " " + attribute(node, "id")
+	if negativeWeight.MatchString(match) {
+		score -= 25
+	}
+	if positiveWeight.MatchString(match) {
+		score += 25
+	}
+	return score
+}
+
+// linkDensity returns the proportion of the text in the node that is inside links.
+func linkDensity(node *html.Node) float64 {
+	length := utf8.RuneCountInString(nodeText(node))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			linkLength += utf8.RuneCountInString(nodeText(n))
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return float64(linkLength) / float64(length)
+}
+
+// nodeText returns the text content of the node with whitespace collapsed.
+func nodeText(node *html.Node) string {
+	var builder strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+			builder.WriteString(" ")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// storeArticle fetches the full article for the post from its url and stores the main
+// content of it alongside the post, so that it can be read offline.
+func storeArticle(ctx context.Context, s *state, post database.Post) error {
+	content, err := fetchArticle(ctx, s.client, post.Url)
+	if err != nil {
+		return err
+	}
+	return s.db.UpsertArticle(ctx, database.UpsertArticleParams{
+		PostID:  post.ID,
+		Url:     post.Url,
+		Content: content,
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattr/gator/internal/database"
+	"net/http"
+	"time"
+)
+
+// defaultFailureThreshold is the number of failed fetches in a row after which a feed is
+// disabled, when none is configured.
+const defaultFailureThreshold = 10
+
+// markFeedFailed records that worker failed to fetch the feed with err, disabling the feed
+// if it has now failed too many times in a row, and schedules it to be retried (after the
+// time the server asked for, if it gave one). Rate limited (429) fetches are not counted
+// towards disabling the feed.
+func markFeedFailed(ctx context.Context, s *state, feed database.Feed, worker string, fetchErr error) error {
+	threshold := s.config.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+
+	var status sql.NullInt32
+	var wait time.Duration
+	rateLimited := false
+	var statusErr *statusError
+	if errors.As(fetchErr, &statusErr) {
+		status = sql.NullInt32{Int32: int32(statusErr.StatusCode), Valid: true}
+		wait = statusErr.RetryAfter
+		rateLimited = statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	failed, err := s.db.MarkFeedFailed(ctx, database.MarkFeedFailedParams{
+		LastStatus:       status,
+		LastError:        sql.NullString{String: fetchErr.Error(), Valid: true},
+		Worker:           nullString(worker),
+		RateLimited:      rateLimited,
+		FailureThreshold: int32(threshold),
+		ID:               feed.ID,
+		LeasedBy:         feed.LeasedBy,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return errLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+	if failed.DisabledAt.Valid {
+		fmt.Printf("Disabled %s after %d failed fetches in a row, run enable to try it again\n",
+			failed.Name, failed.ConsecutiveFailures)
+		return s.db.ReleaseFeedLease(ctx, database.ReleaseFeedLeaseParams{ID: failed.ID, Worker: failed.LeasedBy})
+	}
+	return scheduleFeed(ctx, s, failed, false, wait)
+}
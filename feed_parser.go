@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html/charset"
+	"html"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseFeed detects the format of the feed in data and parses it into an RSSFeed.
+// Atom, RSS 1.0 (RDF) and JSON feeds are normalized into the RSSFeed model. The contentType is the
+// Content-Type header of the response the feed was read from, if known.
+func parseFeed(data []byte, contentType string) (*RSSFeed, error) {
+	data, err := toUTF8(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if isJSONFeed(data, contentType) {
+		jsonFeed := &JSONFeed{}
+		err = json.Unmarshal(data, jsonFeed)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(jsonFeed.Version, jsonFeedVersionPrefix) {
+			return nil, errors.New("unsupported JSON document: not a JSON feed")
+		}
+		return unescapeFeed(jsonFeed.toRSSFeed()), nil
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var feed *RSSFeed
+	switch root {
+	case "rss":
+		feed = &RSSFeed{}
+		err = decodeXML(data, feed)
+	case "feed":
+		atom := &AtomFeed{}
+		err = decodeXML(data, atom)
+		feed = atom.toRSSFeed()
+	case "RDF":
+		rdf := &RDFFeed{}
+		err = decodeXML(data, rdf)
+		feed = rdf.toRSSFeed()
+	default:
+		return nil, fmt.Errorf("unsupported feed format <%s>", root)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return unescapeFeed(feed), nil
+}
+
+// unescapeFeed decodes any HTML entities left in the titles and descriptions of the feed.
+func unescapeFeed(feed *RSSFeed) *RSSFeed {
+	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
+	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
+	for i := range feed.Channel.Item {
+		item := &feed.Channel.Item[i]
+		item.Title = html.UnescapeString(item.Title)
+		item.Description = html.UnescapeString(item.Description)
+		item.Author = html.UnescapeString(item.Author)
+		item.DCCreator = html.UnescapeString(item.DCCreator)
+	}
+	return feed
+}
+
+// jsonFeedVersionPrefix is the prefix of the version of every JSON feed, which is the URL
+// of the version of the specification it follows.
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/"
+
+// isJSONFeed reports whether the document is JSON, and so may be a JSON feed, based on the
+// content type or, failing that, on the first non-whitespace character of the body. The
+// version of the parsed document must still be checked.
+func isJSONFeed(data []byte, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/feed+json", "application/json":
+		return true
+	}
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// rootElement returns the local name of the root element of the XML document in data.
+func rootElement(data []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("feed document is empty")
+		}
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// decodeXML unmarshals the XML document in data into v, converting it to UTF-8 from the
+// encoding given in its XML declaration.
+func decodeXML(data []byte, v any) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder.Decode(v)
+}
+
+// xmlEncoding matches the encoding given in an XML declaration.
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// toUTF8 converts the document in data to UTF-8 using the charset from the Content-Type
+// header. Documents with an encoding in their XML declaration are left unchanged, since
+// the declaration is handled when the XML is decoded. Documents with no charset at all
+// that are not valid UTF-8 are assumed to be windows-1252, which is the most common
+// mistake made by publishers. Any UTF-8 byte order mark is removed.
+func toUTF8(data []byte, contentType string) ([]byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if xmlEncoding.Match(data) {
+		return data, nil
+	}
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = params["charset"]
+	}
+	if label == "" {
+		if utf8.Valid(data) {
+			return data, nil
+		}
+		label = "windows-1252"
+	}
+	encoding, name := charset.Lookup(label)
+	if encoding == nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	if name == "utf-8" {
+		return data, nil
+	}
+	return encoding.NewDecoder().Bytes(data)
+}
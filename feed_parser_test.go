@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// parsedItem is the part of a parsed item that is compared in the tests.
+type parsedItem struct {
+	GUID        string
+	Title       string
+	Link        string
+	Description string
+	Author      string
+	Published   time.Time
+}
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		wantErr     bool
+		wantTitle   string
+		wantItems   []parsedItem
+	}{
+		{
+			name: "rss",
+			data: `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Example</title>
+<item><guid>1</guid><title>First &amp;amp; best</title><link>https://example.com/1</link>
+<description>One</description><pubDate>Tue, 10 Jun 2003 04:00:00 GMT</pubDate><author>al@example.com</author></item>
+</channel></rss>`,
+			contentType: "application/rss+xml",
+			wantTitle:   "Example",
+			wantItems: []parsedItem{
+				{"1", "First & best", "https://example.com/1", "One", "al@example.com", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name: "atom",
+			data: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Example</title>
+<link rel="self" href="https://example.com/atom.xml"/><link href="https://example.com/"/>
+<entry><id>urn:1</id><title>First</title>
+<link rel="enclosure" href="https://example.com/1.mp3"/><link rel="alternate" href="https://example.com/1"/>
+<updated>2003-06-10T05:00:00Z</updated><published>2003-06-10T04:00:00Z</published>
+<summary>One</summary><author><name>Al</name></author><author><email>bo@example.com</email></author></entry>
+<entry><id>urn:2</id><title>Second</title><link href="https://example.com/2"/>
+<updated>2003-06-11T04:00:00Z</updated><content type="xhtml"><div>Two</div></content></entry>
+</feed>`,
+			contentType: "application/atom+xml",
+			wantTitle:   "Example",
+			wantItems: []parsedItem{
+				{"urn:1", "First", "https://example.com/1", "One", "Al, bo@example.com", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+				{"urn:2", "Second", "https://example.com/2", "<div>Two</div>", "", time.Date(2003, 6, 11, 4, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name: "json feed",
+			data: `{"version": "https://jsonfeed.org/version/1.1", "title": "Example", "items": [
+{"id": "1", "url": "https://example.com/1", "title": "First", "content_text": "One",
+ "date_published": "2003-06-10T04:00:00Z", "author": {"name": "Al"}, "authors": [{"name": "Al"}]},
+{"id": "2", "external_url": "https://example.com/2", "title": "Second", "summary": "Two",
+ "date_modified": "2003-06-11T04:00:00Z", "author": {"name": "Bo"}}]}`,
+			contentType: "application/feed+json",
+			wantTitle:   "Example",
+			wantItems: []parsedItem{
+				{"1", "First", "https://example.com/1", "One", "Al", time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC)},
+				{"2", "Second", "https://example.com/2", "Two", "Bo", time.Date(2003, 6, 11, 4, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:        "json feed detected from the body",
+			data:        ` {"version": "https://jsonfeed.org/version/1", "title": "Example", "items": []}`,
+			contentType: "text/plain",
+			wantTitle:   "Example",
+		},
+		{
+			name:        "json without a version",
+			data:        `{"title": "Example", "items": []}`,
+			contentType: "application/json",
+			wantErr:     true,
+		},
+		{
+			name:        "json with another version",
+			data:        `{"version": "1.0", "title": "Example"}`,
+			contentType: "application/json",
+			wantErr:     true,
+		},
+		{
+			name: "rdf",
+			data: `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/"
+ xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel rdf:about="https://example.com/"><title>Example</title><link>https://example.com/</link>
+<items><rdf:Seq><rdf:li rdf:resource="https://example.com/1"/></rdf:Seq></items></channel>
+<item rdf:about="https://example.com/1"><title>First</title><link>https://example.com/1</link>
+<description>One</description><dc:date>2003-06-10T04:00:00+02:00</dc:date><dc:creator>Al</dc:creator></item>
+<item rdf:about="https://example.com/2"><title>Second</title><link>https://example.com/2</link></item>
+</rdf:RDF>`,
+			contentType: "application/rdf+xml",
+			wantTitle:   "Example",
+			wantItems: []parsedItem{
+				{"https://example.com/1", "First", "https://example.com/1", "One", "Al", time.Date(2003, 6, 10, 2, 0, 0, 0, time.UTC)},
+				{"https://example.com/2", "Second", "https://example.com/2", "", "", time.Time{}},
+			},
+		},
+		{
+			name:        "iso-8859-1 from the xml declaration",
+			data:        "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><title>Caf\xe9</title></channel></rss>",
+			contentType: "application/rss+xml",
+			wantTitle:   "Café",
+		},
+		{
+			name:        "xml declaration over content type",
+			data:        "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss><channel><title>Caf\xe9</title></channel></rss>",
+			contentType: "application/rss+xml; charset=utf-8",
+			wantTitle:   "Café",
+		},
+		{
+			name:        "iso-8859-1 from the content type",
+			data:        "<?xml version=\"1.0\"?><rss><channel><title>Caf\xe9</title></channel></rss>",
+			contentType: "text/xml; charset=ISO-8859-1",
+			wantTitle:   "Café",
+		},
+		{
+			name:        "windows-1252 without a charset",
+			data:        "<rss><channel><title>\x93Caf\xe9\x94</title></channel></rss>",
+			contentType: "text/xml",
+			wantTitle:   "“Café”",
+		},
+		{
+			name:        "unsupported format",
+			data:        `<html><body>Not a feed</body></html>`,
+			contentType: "text/html",
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		feed, err := parseFeed([]byte(test.data), test.contentType)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if feed.Channel.Title != test.wantTitle {
+			t.Errorf("%s: title = %q; want %q", test.name, feed.Channel.Title, test.wantTitle)
+		}
+		var items []parsedItem
+		for _, item := range feed.Channel.Item {
+			items = append(items, parsedItem{
+				GUID:        item.GUID,
+				Title:       item.Title,
+				Link:        item.Link,
+				Description: item.Description,
+				Author:      item.author(),
+				Published:   item.publishedAt().Time.UTC(),
+			})
+		}
+		if !reflect.DeepEqual(items, test.wantItems) {
+			t.Errorf("%s: items = %+v; want %+v", test.name, items, test.wantItems)
+		}
+	}
+}
@@ -3,6 +3,16 @@ module github.com/mattr/gator
 go 1.24.0
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.10.9
+)
+
+require (
+	golang.org/x/net v0.44.0
+	golang.org/x/term v0.35.0
+)
+
+require (
+	golang.org/x/sys v0.36.0 // indirect
+	golang.org/x/text v0.29.0 // indirect
 )
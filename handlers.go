@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/mattr/gator/internal/database"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,11 +18,11 @@ import (
 // otherwise sets the configuration to use the specified user.
 //
 // Invoked with the 'login' argument
-func handlerLogin(s *state, cmd command) error {
+func handlerLogin(ctx context.Context, s *state, cmd command) error {
 	if len(cmd.args) == 0 {
 		return errors.New("login handler expects a single argument (username)")
 	}
-	user, err := s.db.GetUserByName(context.Background(), cmd.args[0])
+	user, err := s.db.GetUserByName(ctx, cmd.args[0])
 	if err != nil {
 		return err
 	}
@@ -35,11 +38,11 @@ func handlerLogin(s *state, cmd command) error {
 // The username must be unique; returns an error if another user with the same name already exists.
 //
 // Invoked with the register argument
-func handlerRegister(s *state, cmd command) error {
+func handlerRegister(ctx context.Context, s *state, cmd command) error {
 	if len(cmd.args) == 0 || len(cmd.args[0]) == 0 {
 		return errors.New("register handler expects a single argument (username)")
 	}
-	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{ID: uuid.New(), Name: cmd.args[0]})
+	user, err := s.db.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Name: cmd.args[0]})
 	if err != nil {
 		return err
 	}
@@ -55,15 +58,15 @@ func handlerRegister(s *state, cmd command) error {
 // handlerReset provides a reset function to remove all users (and by cascade, all feeds and follows).
 //
 // Invoked with the reset argument
-func handlerReset(s *state, cmd command) error {
-	return s.db.DeleteAllUsers(context.Background())
+func handlerReset(ctx context.Context, s *state, cmd command) error {
+	return s.db.DeleteAllUsers(ctx)
 }
 
 // handlerUsers lists all the users currently registered in the system
 //
 // Invoked with the users argument
-func handlerUsers(s *state, cmd command) error {
-	users, err := s.db.GetUsers(context.Background())
+func handlerUsers(ctx context.Context, s *state, cmd command) error {
+	users, err := s.db.GetUsers(ctx)
 	if err != nil {
 		return err
 	}
@@ -77,37 +80,62 @@ func handlerUsers(s *state, cmd command) error {
 	return nil
 }
 
-// handlerAggregator fetches a feed from a URL and stores it's configuration in the database.
+// handlerAggregator periodically fetches the feeds that are due and stores their posts.
+// With --workers, that many feeds are fetched at once. It runs until interrupted, when
+// it lets the feeds being fetched finish and prints a summary.
 //
 // Invoked with the agg argument
-func handlerAggregator(s *state, cmd command) error {
-	if len(cmd.args) == 0 {
+func handlerAggregator(ctx context.Context, s *state, cmd command) error {
+	workers := 1
+	var interval string
+
+	for i := 0; i < len(cmd.args); i++ {
+		switch cmd.args[i] {
+		case "--workers":
+			if i+1 == len(cmd.args) {
+				return errors.New("--workers expects a number of workers")
+			}
+			i++
+			n, err := strconv.Atoi(cmd.args[i])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of workers %q", cmd.args[i])
+			}
+			workers = n
+		default:
+			interval = cmd.args[i]
+		}
+	}
+	if interval == "" {
 		return errors.New("aggregator handler expects a single argument (time_between_reqs)")
 	}
 
-	duration, err := time.ParseDuration(cmd.args[0])
+	duration, err := time.ParseDuration(interval)
 	if err != nil {
 		return err
 	}
 
-	ticker := time.NewTicker(duration)
-	for ; ; <-ticker.C {
-		err := scrapeFeeds(s)
-		if err != nil {
-			return err
-		}
+	aggregator, err := newAggregator(s, workers)
+	if err != nil {
+		return err
 	}
+	return aggregator.run(ctx, duration)
 }
 
-// handlerFeeds lists all feeds currently stored in the database
+// handlerFeeds lists all feeds currently stored in the database. With --broken, only the
+// feeds that failed to be fetched last time, or have been disabled, are listed along with
+// the error.
 //
 // Invoked with the feeds argument
-func handlerFeeds(s *state, cmd command) error {
-	users, err := s.db.GetUsers(context.Background())
+func handlerFeeds(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) > 0 && cmd.args[0] == "--broken" {
+		return listBrokenFeeds(ctx, s)
+	}
+
+	users, err := s.db.GetUsers(ctx)
 	if err != nil {
 		return err
 	}
-	feeds, err := s.db.GetFeeds(context.Background())
+	feeds, err := s.db.GetFeeds(ctx)
 	if err != nil {
 		return err
 	}
@@ -121,27 +149,80 @@ func handlerFeeds(s *state, cmd command) error {
 	return nil
 }
 
+// listBrokenFeeds lists the feeds that are failing or disabled, with the last error.
+func listBrokenFeeds(ctx context.Context, s *state) error {
+	feeds, err := s.db.GetBrokenFeeds(ctx)
+	if err != nil {
+		return err
+	}
+	for _, feed := range feeds {
+		status := fmt.Sprintf("failed %d times in a row", feed.ConsecutiveFailures)
+		if feed.DisabledAt.Valid {
+			status = fmt.Sprintf("disabled since %s after %d failures", feed.DisabledAt.Time.Format(time.DateTime),
+				feed.ConsecutiveFailures)
+		}
+		fmt.Printf("%s %s (%s)\n", feed.Name, feed.Url, status)
+		if feed.LastError.Valid {
+			fmt.Printf("    %s\n", feed.LastError.String)
+		}
+	}
+	return nil
+}
+
+// handlerEnable re-enables a feed that was disabled after failing too many times, so that
+// it is fetched again straight away.
+//
+// Invoked with the enable argument.
+func handlerEnable(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return errors.New("enable handler expects a single argument (url)")
+	}
+
+	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	return s.db.EnableFeed(ctx, feed.ID)
+}
+
 // handlerAddFeed adds a new feed to the database. The current user is stored as the
-// creator.
+// creator. If the url is a web page rather than a feed, the feeds it advertises are
+// discovered; a single feed is added directly, otherwise the candidates are listed for
+// the user to choose from.
 //
 // Invoked with the addfeed argument.
-func handlerAddFeed(s *state, cmd command, user database.User) error {
+func handlerAddFeed(ctx context.Context, s *state, cmd command, user database.User) error {
 	if len(cmd.args) < 2 {
 		return errors.New("add feed handler expects two arguments (name and url)")
 	}
 
 	name := cmd.args[0]
-	url := cmd.args[1]
+	candidates, err := discoverFeeds(ctx, s.client, cmd.args[1])
+	if err != nil {
+		return err
+	}
+	switch len(candidates) {
+	case 0:
+		return fmt.Errorf("no feeds found at %s", cmd.args[1])
+	case 1:
+	default:
+		fmt.Printf("Found %d feeds at %s:\n", len(candidates), cmd.args[1])
+		for _, candidate := range candidates {
+			fmt.Printf("* %s '%s'\n", candidate.Title, candidate.URL)
+		}
+		return errors.New("multiple feeds found; run addfeed again with one of the urls above")
+	}
+	url := candidates[0].URL
 
 	feedParams := database.CreateFeedParams{ID: uuid.New(), Name: name, Url: url, UserID: user.ID}
 
-	feed, err := s.db.CreateFeed(context.Background(), feedParams)
+	feed, err := s.db.CreateFeed(ctx, feedParams)
 	if err != nil {
 		return err
 	}
 
 	followParams := database.CreateFeedFollowParams{ID: uuid.New(), UserID: user.ID, FeedID: feed.ID}
-	_, err = s.db.CreateFeedFollow(context.Background(), followParams)
+	_, err = s.db.CreateFeedFollow(ctx, followParams)
 	if err != nil {
 		return err
 	}
@@ -153,18 +234,18 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 // handlerFeedFollow follows a feed specified by URL for the current user.
 //
 // Invoked with the follow argument
-func handlerFeedFollow(s *state, cmd command, user database.User) error {
+func handlerFeedFollow(ctx context.Context, s *state, cmd command, user database.User) error {
 	if len(cmd.args) == 0 {
 		return errors.New("follow handler expects a single argument (url)")
 	}
 
-	feed, err := s.db.GetFeedByURL(context.Background(), cmd.args[0])
+	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
 	if err != nil {
 		return err
 	}
 
 	params := database.CreateFeedFollowParams{ID: uuid.New(), UserID: user.ID, FeedID: feed.ID}
-	follow, err := s.db.CreateFeedFollow(context.Background(), params)
+	follow, err := s.db.CreateFeedFollow(ctx, params)
 	if err != nil {
 		return err
 	}
@@ -176,8 +257,8 @@ func handlerFeedFollow(s *state, cmd command, user database.User) error {
 // handlerFeedFollowing lists all the feeds that the current user is following
 //
 // Invoked with the following argument.
-func handlerFeedFollowing(s *state, cmd command, user database.User) error {
-	feeds, err := s.db.GetFeedsForUser(context.Background(), user.ID)
+func handlerFeedFollowing(ctx context.Context, s *state, cmd command, user database.User) error {
+	feeds, err := s.db.GetFeedsForUser(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -192,29 +273,274 @@ func handlerFeedFollowing(s *state, cmd command, user database.User) error {
 // handlerFeedUnfollow removes a feed from the current user's follows
 //
 // Invoked with the unfollow argument.
-func handlerFeedUnfollow(s *state, cmd command, user database.User) error {
+func handlerFeedUnfollow(ctx context.Context, s *state, cmd command, user database.User) error {
 	if len(cmd.args) == 0 {
 		return errors.New("unfollow handler expects a single argument (url)")
 	}
 
 	params := database.DeleteFeedFollowParams{UserID: user.ID, Url: cmd.args[0]}
-	return s.db.DeleteFeedFollow(context.Background(), params)
+	return s.db.DeleteFeedFollow(ctx, params)
 }
 
-func handlerBrowse(s *state, cmd command, user database.User) error {
+// handlerBrowse lists the most recent posts from the feeds the current user is following,
+// along with any enclosures (e.g. podcast episodes) attached to them. The posts can be
+// limited to those with a tag using the --tag option, and the full content of each post
+// is shown with the --full option.
+//
+// Invoked with the browse argument.
+func handlerBrowse(ctx context.Context, s *state, cmd command, user database.User) error {
 	limit := 2
+	tag := sql.NullString{}
+	full := false
+
+	for i := 0; i < len(cmd.args); i++ {
+		switch cmd.args[i] {
+		case "--tag":
+			if i+1 == len(cmd.args) {
+				return errors.New("--tag expects a tag name")
+			}
+			i++
+			tag = sql.NullString{String: normalizeTag(cmd.args[i]), Valid: true}
+		case "--full":
+			full = true
+		default:
+			limit, _ = strconv.Atoi(cmd.args[i])
+		}
+	}
+
+	params := database.GetPostsForUserParams{UserID: user.ID, Tag: tag, Limit: int32(limit)}
+	posts, err := s.db.GetPostsForUser(ctx, params)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if post.Author.Valid {
+			fmt.Printf("[%s] \"%s\" by %s: %s\n", post.FeedName, post.Title, post.Author.String, post.Url)
+		} else {
+			fmt.Printf("[%s] \"%s\": %s\n", post.FeedName, post.Title, post.Url)
+		}
+		if full {
+			content := post.Content
+			if !content.Valid {
+				content = post.Description
+			}
+			base, _ := url.Parse(post.Url)
+			fmt.Printf("\n%s\n", renderHTML(content.String, terminalWidth(), base))
+		}
+		enclosures, err := s.db.GetEnclosuresForPost(ctx, post.ID)
+		if err != nil {
+			return err
+		}
+		for _, enclosure := range enclosures {
+			fmt.Printf("    Enclosure: %s\n", formatEnclosure(enclosure))
+		}
+	}
+	return nil
+}
+
+// handlerDownload downloads the enclosures (e.g. podcast episodes) of posts from the feeds
+// the current user is following into the download directory. Enclosures that have already
+// been downloaded are skipped, interrupted downloads are resumed, and downloads beyond a
+// feed's keep policy are removed.
+//
+// Invoked with the download argument.
+func handlerDownload(ctx context.Context, s *state, cmd command, user database.User) error {
+	dir, err := downloadDir(s)
+	if err != nil {
+		return err
+	}
+
+	pending, err := s.db.GetPendingDownloads(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	downloaded := make(map[uuid.UUID]bool)
+	for _, enclosure := range pending {
+		// only download one enclosure (the first) for each post
+		if downloaded[enclosure.PostID] {
+			continue
+		}
+		path, err := downloadPath(ctx, s, dir, enclosure)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Downloading %s to %s\n", enclosure.Url, path)
+		size, err := downloadFile(ctx, s.client, enclosure.Url, path)
+		if err != nil {
+			fmt.Println("Error downloading enclosure:", err)
+			continue
+		}
+		params := database.CreateDownloadParams{ID: uuid.New(), EnclosureID: enclosure.ID, Path: path, Size: size}
+		_, err = s.db.CreateDownload(ctx, params)
+		if err != nil {
+			return err
+		}
+		downloaded[enclosure.PostID] = true
+	}
+
+	return removeExpiredDownloads(ctx, s)
+}
+
+// handlerKeep sets the number of most recent episodes of a feed to keep downloaded. Older
+// downloads are removed by the download command. A limit of 0 keeps every episode.
+//
+// Invoked with the keep argument.
+func handlerKeep(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) < 2 {
+		return errors.New("keep handler expects two arguments (url and number of episodes)")
+	}
+
+	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	keep, err := strconv.Atoi(cmd.args[1])
+	if err != nil || keep < 0 {
+		return fmt.Errorf("invalid number of episodes %q", cmd.args[1])
+	}
+
+	params := database.SetFeedDownloadKeepParams{ID: feed.ID, DownloadKeep: sql.NullInt32{Int32: int32(keep), Valid: keep > 0}}
+	return s.db.SetFeedDownloadKeep(ctx, params)
+}
+
+// handlerFullArticle turns fetching the full article of each new post of a feed on or off.
+// The main content of the page each post links to is then stored with the post when the
+// feed is aggregated, so that it can be read offline with the read command.
+//
+// Invoked with the fullarticle argument.
+func handlerFullArticle(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) < 2 {
+		return errors.New("fullarticle handler expects two arguments (url and on or off)")
+	}
+
+	feed, err := s.db.GetFeedByURL(ctx, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	var enabled bool
+	switch cmd.args[1] {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return fmt.Errorf("expected on or off, got %q", cmd.args[1])
+	}
+
+	params := database.SetFeedFetchFullArticleParams{ID: feed.ID, FetchFullArticle: enabled}
+	return s.db.SetFeedFetchFullArticle(ctx, params)
+}
+
+// handlerTags lists the most common tags of posts from the feeds the current user is
+// following, along with the number of posts with each tag.
+//
+// Invoked with the tags argument.
+func handlerTags(ctx context.Context, s *state, cmd command, user database.User) error {
+	limit := 20
 
 	if len(cmd.args) > 0 {
 		limit, _ = strconv.Atoi(cmd.args[0])
 	}
 
-	params := database.GetPostsForUserParams{UserID: user.ID, Limit: int32(limit)}
-	posts, err := s.db.GetPostsForUser(context.Background(), params)
+	params := database.GetTagsForUserParams{UserID: user.ID, Limit: int32(limit)}
+	tags, err := s.db.GetTagsForUser(ctx, params)
 	if err != nil {
 		return err
 	}
-	for _, post := range posts {
-		fmt.Printf("[%s] \"%s\": %s\n", post.FeedName, post.Title, post.Url)
+	for _, tag := range tags {
+		fmt.Printf("* %s (%d)\n", tag.Name, tag.PostCount)
 	}
 	return nil
 }
+
+// handlerHistory shows the changes a publisher has made to a post since it was first stored.
+// The post is given by its url (or its id).
+//
+// Invoked with the history argument.
+func handlerHistory(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return errors.New("history handler expects a single argument (post url)")
+	}
+
+	post, err := getPost(ctx, s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	revisions, err := s.db.GetPostRevisions(ctx, post.ID)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		fmt.Printf("\"%s\" has not changed since it was first seen on %s\n", post.Title, post.CreatedAt.Format(time.DateTime))
+		return nil
+	}
+
+	var versions []postVersion
+	for _, revision := range revisions {
+		versions = append(versions, postVersion{
+			Title:       revision.Title,
+			Url:         revision.Url,
+			Author:      revision.Author,
+			Description: revision.Description,
+			Content:     revision.Content,
+			SeenAt:      revision.FirstSeenAt,
+		})
+	}
+	versions = append(versions, postVersion{
+		Title:       post.Title,
+		Url:         post.Url,
+		Author:      post.Author,
+		Description: post.Description,
+		Content:     post.Content,
+		SeenAt:      post.ContentChangedAt,
+	})
+
+	fmt.Printf("\"%s\" has changed %d times since it was first seen on %s\n",
+		post.Title, len(revisions), post.CreatedAt.Format(time.DateTime))
+	for i := 1; i < len(versions); i++ {
+		fmt.Printf("\nChanges seen on %s:\n", versions[i].SeenAt.Format(time.DateTime))
+		fmt.Print(formatDiff(versions[i-1].text(), versions[i].text()))
+	}
+	return nil
+}
+
+// handlerRead shows a post as readable text, wrapped to the width of the terminal and
+// shown through the pager when run in a terminal. The full article is shown if it has been
+// fetched, otherwise the content of the post. The post is given by its url (or its id).
+//
+// Invoked with the read argument.
+func handlerRead(ctx context.Context, s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return errors.New("read handler expects a single argument (post url)")
+	}
+
+	post, err := getPost(ctx, s, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	var header strings.Builder
+	header.WriteString(post.Title + "\n")
+	if post.Author.Valid {
+		header.WriteString("by " + post.Author.String + "\n")
+	}
+	if post.PublishedAt.Valid {
+		header.WriteString(post.PublishedAt.Time.Format("Monday, 2 January 2006") + "\n")
+	}
+	header.WriteString(post.Url + "\n\n")
+
+	body := post.Content
+	if !body.Valid {
+		body = post.Description
+	}
+	article, err := s.db.GetArticleForPost(ctx, post.ID)
+	if err == nil {
+		body = sql.NullString{String: article.Content, Valid: true}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	base, _ := url.Parse(post.Url)
+	return page(header.String() + renderHTML(body.String, terminalWidth(), base))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// contentHash returns a hash of the content of a post, used to detect when a publisher has
+// edited it. It must match the hash used to backfill existing posts when the content_hash
+// column was added.
+func contentHash(title, url string, author, description, content sql.NullString) string {
+	fields := []string{title, url, author.String, description.String, content.String}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// postVersion is a version of a post, either one of its revisions or the current post.
+type postVersion struct {
+	Title       string
+	Url         string
+	Author      sql.NullString
+	Description sql.NullString
+	Content     sql.NullString
+	SeenAt      time.Time
+}
+
+// text returns the version as plain text, for comparison with other versions.
+func (v postVersion) text() string {
+	body := v.Content
+	if !body.Valid {
+		body = v.Description
+	}
+	var builder strings.Builder
+	builder.WriteString("Title: " + v.Title + "\n")
+	builder.WriteString("URL: " + v.Url + "\n")
+	if v.Author.Valid {
+		builder.WriteString("Author: " + v.Author.String + "\n")
+	}
+	builder.WriteString("\n" + htmlToText(body.String))
+	return builder.String()
+}
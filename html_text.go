@@ -0,0 +1,55 @@
+package main
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+// blockElements are the HTML elements that start a new line when converted to text.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "figure": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "tr": true, "ul": true,
+}
+
+// blankLines matches runs of more than one blank line.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// htmlToText converts an HTML fragment to plain text, keeping line breaks between block
+// elements and dropping scripts and styles.
+func htmlToText(fragment string) string {
+	var builder strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	skip := 0
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			lines := strings.Split(builder.String(), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+			return strings.TrimSpace(text)
+		case html.TextToken:
+			if skip == 0 {
+				builder.WriteString(whitespace.ReplaceAllString(string(tokenizer.Text()), " "))
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if tag == "script" || tag == "style" {
+				if tokenType == html.StartTagToken {
+					skip++
+				} else if tokenType == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			}
+			if blockElements[tag] {
+				builder.WriteString("\n")
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/mattr/gator/internal/config"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// defaultUserAgent is sent with every request when no user agent is configured.
+	defaultUserAgent = "Gator"
+	// defaultConnectTimeout is the time allowed to connect to a server, including the TLS handshake.
+	defaultConnectTimeout = 10 * time.Second
+	// defaultReadTimeout is the time allowed for a server to respond once a request has been sent.
+	defaultReadTimeout = 30 * time.Second
+	// defaultTimeout is the time allowed for a whole request, including reading the body, but
+	// not waiting for the host limiter.
+	defaultTimeout = time.Minute
+	// defaultMaxResponseSize is the largest feed or page that is read, in bytes.
+	defaultMaxResponseSize = 10 << 20
+)
+
+// httpClient is the HTTP client shared by every request gator makes, so that connections
+// to a server are reused between requests.
+type httpClient struct {
+	*http.Client
+	userAgent string
+	// maxResponseSize is the largest response body that readBody reads, in bytes.
+	maxResponseSize int64
+}
+
+// newHTTPClient returns an httpClient configured with the timeouts, proxy, trusted
+// certificates, maximum response size, user agent and per-host delays in the config.
+func newHTTPClient(cfg *config.Config) (*httpClient, error) {
+	connectTimeout, err := parseDurationOr(cfg.HTTPConnectTimeout, defaultConnectTimeout, "http_connect_timeout")
+	if err != nil {
+		return nil, err
+	}
+	readTimeout, err := parseDurationOr(cfg.HTTPReadTimeout, defaultReadTimeout, "http_read_timeout")
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseDurationOr(cfg.HTTPTimeout, defaultTimeout, "http_timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = readTimeout
+	// the aggregator's workers often fetch several feeds from the same host
+	transport.MaxIdleConnsPerHost = 16
+
+	if cfg.HTTPProxy != "" {
+		proxyURL, err := url.Parse(cfg.HTTPProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid http_proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cfg.HTTPCABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.HTTPCABundle)
+		if err != nil {
+			return nil, fmt.Errorf("reading http_ca_bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in http_ca_bundle %s", cfg.HTTPCABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	// the timeout starts once the limiter lets a request through, so that requests queued
+	// for a busy host do not time out before they are made
+	limiter, err := newHostLimiter(cfg, &timeoutTransport{base: transport, timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &httpClient{
+		Client:          &http.Client{Transport: limiter},
+		userAgent:       defaultUserAgent,
+		maxResponseSize: defaultMaxResponseSize,
+	}
+	if cfg.UserAgent != "" {
+		client.userAgent = cfg.UserAgent
+	}
+	if cfg.HTTPMaxResponseSize > 0 {
+		client.maxResponseSize = cfg.HTTPMaxResponseSize
+	}
+	return client, nil
+}
+
+// newRequest returns a GET request for the URL with gator's user agent.
+func (c *httpClient) newRequest(ctx context.Context, requestURL string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", c.userAgent)
+	return request, nil
+}
+
+// readBody reads the body of the response, failing if it is larger than the maximum
+// response size.
+func (c *httpClient) readBody(response *http.Response) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(response.Body, c.maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > c.maxResponseSize {
+		return nil, fmt.Errorf("response is larger than the maximum of %d bytes", c.maxResponseSize)
+	}
+	return data, nil
+}
+
+// noTimeoutKey marks the context of a request that the http_timeout does not apply to.
+type noTimeoutKey struct{}
+
+// withoutTimeout returns a context for requests that the http_timeout does not apply to,
+// such as downloads.
+func withoutTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+// timeoutTransport is an http.RoundTripper that limits the time allowed for each request,
+// including reading the body of the response.
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip makes the request, cancelling it if it takes longer than the timeout.
+func (t *timeoutTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 || request.Context().Value(noTimeoutKey{}) != nil {
+		return t.base.RoundTrip(request)
+	}
+	ctx, cancel := context.WithTimeout(request.Context(), t.timeout)
+	response, err := t.base.RoundTrip(request.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	response.Body = &cancelBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// cancelBody is a response body that cancels the context of its request when it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// parseDurationOr parses a duration from the config, returning def if it is not set.
+func parseDurationOr(value string, def time.Duration, name string) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return duration, nil
+}
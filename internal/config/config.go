@@ -8,8 +8,24 @@ import (
 const configFileName = "/.gatorconfig.json"
 
 type Config struct {
-	CurrentUserName string `json:"current_user_name"`
-	DatabaseURL     string `json:"db_url"`
+	CurrentUserName  string            `json:"current_user_name"`
+	DatabaseURL      string            `json:"db_url"`
+	DownloadDir      string            `json:"download_dir,omitempty"`
+	DownloadTemplate string            `json:"download_template,omitempty"`
+	MinFetchInterval string            `json:"min_fetch_interval,omitempty"`
+	MaxFetchInterval string            `json:"max_fetch_interval,omitempty"`
+	HostDelay        string            `json:"host_delay,omitempty"`
+	HostDelays       map[string]string `json:"host_delays,omitempty"`
+	FailureThreshold int               `json:"failure_threshold,omitempty"`
+	LeaseDuration    string            `json:"lease_duration,omitempty"`
+
+	HTTPConnectTimeout  string `json:"http_connect_timeout,omitempty"`
+	HTTPReadTimeout     string `json:"http_read_timeout,omitempty"`
+	HTTPTimeout         string `json:"http_timeout,omitempty"`
+	HTTPProxy           string `json:"http_proxy,omitempty"`
+	HTTPCABundle        string `json:"http_ca_bundle,omitempty"`
+	HTTPMaxResponseSize int64  `json:"http_max_response_size,omitempty"`
+	UserAgent           string `json:"user_agent,omitempty"`
 }
 
 func (cfg *Config) SetUser(username string) error {
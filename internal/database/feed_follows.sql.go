@@ -72,3 +72,23 @@ func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowPara
 	_, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.UserID, arg.Url)
 	return err
 }
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+update feed_follows
+set updated_at = now(),
+    feed_id    = $1
+where feed_follows.feed_id = $2
+  and feed_follows.user_id not in (select existing.user_id
+                                   from feed_follows existing
+                                   where existing.feed_id = $1)
+`
+
+type MoveFeedFollowsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
@@ -7,14 +7,93 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimDueFeeds = `-- name: ClaimDueFeeds :many
+with due as (select feeds.id
+             from feeds
+             where feeds.disabled_at is null
+               and (feeds.next_fetch_at is null or feeds.next_fetch_at <= now())
+               and (feeds.lease_expires_at is null or feeds.lease_expires_at <= now())
+               and not extract(hour from now() at time zone 'UTC')::integer = any (feeds.skip_hours)
+               and not to_char(now() at time zone 'UTC', 'FMDay') = any (feeds.skip_days)
+             order by feeds.next_fetch_at asc nulls first, feeds.last_fetched_at asc nulls first
+             limit $1 for update skip locked)
+update feeds
+set leased_by        = $2,
+    lease_expires_at = now() + $3::integer * interval '1 second'
+from due
+where feeds.id = due.id
+returning feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.download_keep, feeds.fetch_full_article, feeds.ttl, feeds.skip_hours, feeds.skip_days, feeds.update_period, feeds.update_frequency, feeds.next_fetch_at, feeds.unchanged_fetches, feeds.last_error, feeds.last_status, feeds.consecutive_failures, feeds.disabled_at, feeds.leased_by, feeds.lease_expires_at, feeds.last_fetched_by
+`
+
+type ClaimDueFeedsParams struct {
+	Limit        int32
+	Worker       sql.NullString
+	LeaseSeconds int32
+}
+
+// Leases the feeds that are due to be fetched to a worker, so that other workers (in this or
+// another process) do not fetch them too. A feed is due once its next fetch time has passed,
+// unless the current hour or day (in GMT) is one the publisher asks to be skipped, and is not
+// leased unless the lease has expired, e.g. because the worker holding it crashed.
+func (q *Queries) ClaimDueFeeds(ctx context.Context, arg ClaimDueFeedsParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueFeeds, arg.Limit, arg.Worker, arg.LeaseSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.DownloadKeep,
+			&i.FetchFullArticle,
+			&i.Ttl,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+			&i.UpdatePeriod,
+			&i.UpdateFrequency,
+			&i.NextFetchAt,
+			&i.UnchangedFetches,
+			&i.LastError,
+			&i.LastStatus,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.LeasedBy,
+			&i.LeaseExpiresAt,
+			&i.LastFetchedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 insert into feeds(id, created_at, updated_at, name, url, user_id)
 values ($1, now(), now(), $2, $3, $4)
-returning id, created_at, updated_at, name, url, user_id, last_fetched_at
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 `
 
 type CreateFeedParams struct {
@@ -40,12 +119,114 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.DownloadKeep,
+		&i.FetchFullArticle,
+		&i.Ttl,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.UpdatePeriod,
+		&i.UpdateFrequency,
+		&i.NextFetchAt,
+		&i.UnchangedFetches,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.LeasedBy,
+		&i.LeaseExpiresAt,
+		&i.LastFetchedBy,
 	)
 	return i, err
 }
 
+const deleteFeed = `-- name: DeleteFeed :exec
+delete
+from feeds
+where id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const enableFeed = `-- name: EnableFeed :exec
+update feeds
+set updated_at           = now(),
+    disabled_at          = null,
+    consecutive_failures = 0,
+    next_fetch_at        = null,
+    leased_by            = null,
+    lease_expires_at     = null
+where id = $1
+`
+
+func (q *Queries) EnableFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableFeed, id)
+	return err
+}
+
+const getBrokenFeeds = `-- name: GetBrokenFeeds :many
+select id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
+from feeds
+where consecutive_failures > 0
+   or disabled_at is not null
+order by disabled_at asc nulls last, consecutive_failures desc
+`
+
+func (q *Queries) GetBrokenFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getBrokenFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.DownloadKeep,
+			&i.FetchFullArticle,
+			&i.Ttl,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+			&i.UpdatePeriod,
+			&i.UpdateFrequency,
+			&i.NextFetchAt,
+			&i.UnchangedFetches,
+			&i.LastError,
+			&i.LastStatus,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.LeasedBy,
+			&i.LeaseExpiresAt,
+			&i.LastFetchedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getFeedByURL = `-- name: GetFeedByURL :one
-select id, created_at, updated_at, name, url, user_id, last_fetched_at
+select id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 from feeds
 where url = $1
 `
@@ -61,12 +242,30 @@ func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.DownloadKeep,
+		&i.FetchFullArticle,
+		&i.Ttl,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.UpdatePeriod,
+		&i.UpdateFrequency,
+		&i.NextFetchAt,
+		&i.UnchangedFetches,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.LeasedBy,
+		&i.LeaseExpiresAt,
+		&i.LastFetchedBy,
 	)
 	return i, err
 }
 
 const getFeeds = `-- name: GetFeeds :many
-select id, created_at, updated_at, name, url, user_id, last_fetched_at
+select id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 from feeds
 `
 
@@ -87,6 +286,24 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.DownloadKeep,
+			&i.FetchFullArticle,
+			&i.Ttl,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+			&i.UpdatePeriod,
+			&i.UpdateFrequency,
+			&i.NextFetchAt,
+			&i.UnchangedFetches,
+			&i.LastError,
+			&i.LastStatus,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.LeasedBy,
+			&i.LeaseExpiresAt,
+			&i.LastFetchedBy,
 		); err != nil {
 			return nil, err
 		}
@@ -102,7 +319,7 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 }
 
 const getFeedsForUser = `-- name: GetFeedsForUser :many
-select feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at
+select feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.download_keep, feeds.fetch_full_article, feeds.ttl, feeds.skip_hours, feeds.skip_days, feeds.update_period, feeds.update_frequency, feeds.next_fetch_at, feeds.unchanged_fetches, feeds.last_error, feeds.last_status, feeds.consecutive_failures, feeds.disabled_at, feeds.leased_by, feeds.lease_expires_at, feeds.last_fetched_by
 from feeds
          inner join feed_follows on feed_follows.feed_id = feeds.id
          inner join users on users.id = feed_follows.user_id
@@ -126,6 +343,24 @@ func (q *Queries) GetFeedsForUser(ctx context.Context, id uuid.UUID) ([]Feed, er
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.DownloadKeep,
+			&i.FetchFullArticle,
+			&i.Ttl,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+			&i.UpdatePeriod,
+			&i.UpdateFrequency,
+			&i.NextFetchAt,
+			&i.UnchangedFetches,
+			&i.LastError,
+			&i.LastStatus,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.LeasedBy,
+			&i.LeaseExpiresAt,
+			&i.LastFetchedBy,
 		); err != nil {
 			return nil, err
 		}
@@ -140,15 +375,70 @@ func (q *Queries) GetFeedsForUser(ctx context.Context, id uuid.UUID) ([]Feed, er
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-select id, created_at, updated_at, name, url, user_id, last_fetched_at
+const lockLeasedFeed = `-- name: LockLeasedFeed :one
+select id
 from feeds
-order by last_fetched_at asc nulls first
-limit 1
+where id = $1
+  and leased_by = $2
+    for update
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type LockLeasedFeedParams struct {
+	ID       uuid.UUID
+	LeasedBy sql.NullString
+}
+
+// Locks a feed for the rest of the transaction, if it is still leased to the given worker.
+func (q *Queries) LockLeasedFeed(ctx context.Context, arg LockLeasedFeedParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, lockLeasedFeed, arg.ID, arg.LeasedBy)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const markFeedFailed = `-- name: MarkFeedFailed :one
+update feeds
+set updated_at           = now(),
+    last_fetched_at      = now(),
+    last_status          = $1,
+    last_error           = $2,
+    last_fetched_by      = $3,
+    consecutive_failures = case
+                               when $4::boolean then consecutive_failures
+                               else consecutive_failures + 1
+                               end,
+    disabled_at          = case
+                               when not $4::boolean
+                                   and consecutive_failures + 1 >= $5::integer then now()
+                               end
+where id = $6
+  and leased_by = $7
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
+`
+
+type MarkFeedFailedParams struct {
+	LastStatus       sql.NullInt32
+	LastError        sql.NullString
+	Worker           sql.NullString
+	RateLimited      bool
+	FailureThreshold int32
+	ID               uuid.UUID
+	LeasedBy         sql.NullString
+}
+
+// Records a failed fetch of a feed, disabling it once it has failed the given number of times
+// in a row. A feed that is being rate limited is not broken, so the failure is not counted.
+// Only the worker holding the lease on the feed can record a failure.
+func (q *Queries) MarkFeedFailed(ctx context.Context, arg MarkFeedFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFailed,
+		arg.LastStatus,
+		arg.LastError,
+		arg.Worker,
+		arg.RateLimited,
+		arg.FailureThreshold,
+		arg.ID,
+		arg.LeasedBy,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -158,20 +448,280 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.DownloadKeep,
+		&i.FetchFullArticle,
+		&i.Ttl,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.UpdatePeriod,
+		&i.UpdateFrequency,
+		&i.NextFetchAt,
+		&i.UnchangedFetches,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.LeasedBy,
+		&i.LeaseExpiresAt,
+		&i.LastFetchedBy,
 	)
 	return i, err
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :one
 update feeds
-set updated_at      = now(),
-    last_fetched_at = now()
+set updated_at           = now(),
+    last_fetched_at      = now(),
+    last_status          = $2,
+    last_error           = null,
+    consecutive_failures = 0,
+    last_fetched_by      = $3
 where id = $1
-returning id, created_at, updated_at, name, url, user_id, last_fetched_at
+  and leased_by = $4
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedFetched, id)
+type MarkFeedFetchedParams struct {
+	ID            uuid.UUID
+	LastStatus    sql.NullInt32
+	LastFetchedBy sql.NullString
+	LeasedBy      sql.NullString
+}
+
+// Records a successful fetch of a feed by the worker holding the lease on it.
+func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFetched,
+		arg.ID,
+		arg.LastStatus,
+		arg.LastFetchedBy,
+		arg.LeasedBy,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.DownloadKeep,
+		&i.FetchFullArticle,
+		&i.Ttl,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.UpdatePeriod,
+		&i.UpdateFrequency,
+		&i.NextFetchAt,
+		&i.UnchangedFetches,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.LeasedBy,
+		&i.LeaseExpiresAt,
+		&i.LastFetchedBy,
+	)
+	return i, err
+}
+
+const releaseFeedLease = `-- name: ReleaseFeedLease :exec
+update feeds
+set leased_by        = null,
+    lease_expires_at = null
+where id = $1
+  and leased_by = $2
+`
+
+type ReleaseFeedLeaseParams struct {
+	ID     uuid.UUID
+	Worker sql.NullString
+}
+
+// Releases a lease on a feed without fetching it, so that another worker can fetch it.
+func (q *Queries) ReleaseFeedLease(ctx context.Context, arg ReleaseFeedLeaseParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLease, arg.ID, arg.Worker)
+	return err
+}
+
+const scheduleFeed = `-- name: ScheduleFeed :exec
+update feeds
+set updated_at        = now(),
+    next_fetch_at     = now() + $1::integer * interval '1 second',
+    unchanged_fetches = $2,
+    leased_by         = null,
+    lease_expires_at  = null
+where id = $3
+  and leased_by = $4
+`
+
+type ScheduleFeedParams struct {
+	IntervalSeconds  int32
+	UnchangedFetches int32
+	ID               uuid.UUID
+	LeasedBy         sql.NullString
+}
+
+// Sets when the feed is next due to be fetched, releasing the lease on it, unless the lease
+// has expired and been taken by another worker.
+func (q *Queries) ScheduleFeed(ctx context.Context, arg ScheduleFeedParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleFeed,
+		arg.IntervalSeconds,
+		arg.UnchangedFetches,
+		arg.ID,
+		arg.LeasedBy,
+	)
+	return err
+}
+
+const setFeedCacheValidators = `-- name: SetFeedCacheValidators :exec
+update feeds
+set updated_at    = now(),
+    etag          = $2,
+    last_modified = $3
+where id = $1
+  and leased_by = $4
+`
+
+type SetFeedCacheValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+	LeasedBy     sql.NullString
+}
+
+// Stores the cache validators of a feed, once every post in the response they came with has
+// been stored, so that posts that failed to be stored are fetched again.
+func (q *Queries) SetFeedCacheValidators(ctx context.Context, arg SetFeedCacheValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedCacheValidators,
+		arg.ID,
+		arg.Etag,
+		arg.LastModified,
+		arg.LeasedBy,
+	)
+	return err
+}
+
+const setFeedDownloadKeep = `-- name: SetFeedDownloadKeep :exec
+update feeds
+set updated_at    = now(),
+    download_keep = $2
+where id = $1
+`
+
+type SetFeedDownloadKeepParams struct {
+	ID           uuid.UUID
+	DownloadKeep sql.NullInt32
+}
+
+func (q *Queries) SetFeedDownloadKeep(ctx context.Context, arg SetFeedDownloadKeepParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedDownloadKeep, arg.ID, arg.DownloadKeep)
+	return err
+}
+
+const setFeedFetchFullArticle = `-- name: SetFeedFetchFullArticle :exec
+update feeds
+set updated_at         = now(),
+    fetch_full_article = $2
+where id = $1
+`
+
+type SetFeedFetchFullArticleParams struct {
+	ID               uuid.UUID
+	FetchFullArticle bool
+}
+
+func (q *Queries) SetFeedFetchFullArticle(ctx context.Context, arg SetFeedFetchFullArticleParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchFullArticle, arg.ID, arg.FetchFullArticle)
+	return err
+}
+
+const setFeedUpdateHints = `-- name: SetFeedUpdateHints :one
+update feeds
+set updated_at       = now(),
+    ttl              = $2,
+    skip_hours       = $3,
+    skip_days        = $4,
+    update_period    = $5,
+    update_frequency = $6
+where id = $1
+  and leased_by = $7
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
+`
+
+type SetFeedUpdateHintsParams struct {
+	ID              uuid.UUID
+	Ttl             sql.NullInt32
+	SkipHours       []int32
+	SkipDays        []string
+	UpdatePeriod    sql.NullString
+	UpdateFrequency sql.NullInt32
+	LeasedBy        sql.NullString
+}
+
+// Stores the hints the publisher gives about how often to fetch the feed, if it is still
+// leased to the given worker.
+
+func (q *Queries) SetFeedUpdateHints(ctx context.Context, arg SetFeedUpdateHintsParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedUpdateHints,
+		arg.ID,
+		arg.Ttl,
+		pq.Array(arg.SkipHours),
+		pq.Array(arg.SkipDays),
+		arg.UpdatePeriod,
+		arg.UpdateFrequency,
+		arg.LeasedBy,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.DownloadKeep,
+		&i.FetchFullArticle,
+		&i.Ttl,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.UpdatePeriod,
+		&i.UpdateFrequency,
+		&i.NextFetchAt,
+		&i.UnchangedFetches,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.LeasedBy,
+		&i.LeaseExpiresAt,
+		&i.LastFetchedBy,
+	)
+	return i, err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :one
+update feeds
+set updated_at = now(),
+    url        = $2
+where id = $1
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
+`
+
+type UpdateFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, updateFeedURL, arg.ID, arg.Url)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -181,6 +731,24 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.DownloadKeep,
+		&i.FetchFullArticle,
+		&i.Ttl,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.UpdatePeriod,
+		&i.UpdateFrequency,
+		&i.NextFetchAt,
+		&i.UnchangedFetches,
+		&i.LastError,
+		&i.LastStatus,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.LeasedBy,
+		&i.LeaseExpiresAt,
+		&i.LastFetchedBy,
 	)
 	return i, err
 }
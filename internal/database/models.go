@@ -11,14 +11,64 @@ import (
 	"github.com/google/uuid"
 )
 
+type Article struct {
+	PostID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Url       string
+	Content   string
+}
+
+type Download struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	EnclosureID uuid.UUID
+	Path        string
+	Size        int64
+	DeletedAt   sql.NullTime
+}
+
+type Enclosure struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	PostID          uuid.UUID
+	Url             string
+	MimeType        sql.NullString
+	Length          sql.NullInt64
+	DurationSeconds sql.NullInt32
+	Episode         sql.NullInt32
+	Season          sql.NullInt32
+	ImageUrl        sql.NullString
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	DownloadKeep        sql.NullInt32
+	FetchFullArticle    bool
+	Ttl                 sql.NullInt32
+	SkipHours           []int32
+	SkipDays            []string
+	UpdatePeriod        sql.NullString
+	UpdateFrequency     sql.NullInt32
+	NextFetchAt         sql.NullTime
+	UnchangedFetches    int32
+	LastError           sql.NullString
+	LastStatus          sql.NullInt32
+	ConsecutiveFailures int32
+	DisabledAt          sql.NullTime
+	LeasedBy            sql.NullString
+	LeaseExpiresAt      sql.NullTime
+	LastFetchedBy       sql.NullString
 }
 
 type FeedFollow struct {
@@ -30,14 +80,44 @@ type FeedFollow struct {
 }
 
 type Post struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Title            string
+	Url              string
+	Description      sql.NullString
+	PublishedAt      sql.NullTime
+	FeedID           uuid.UUID
+	Author           sql.NullString
+	Content          sql.NullString
+	Guid             string
+	ContentHash      string
+	ContentChangedAt time.Time
+}
+
+type PostRevision struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	PostID      uuid.UUID
 	Title       string
 	Url         string
 	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	Author      sql.NullString
+	Content     sql.NullString
+	ContentHash string
+	FirstSeenAt time.Time
+}
+
+type PostTag struct {
+	PostID uuid.UUID
+	TagID  uuid.UUID
+}
+
+type Tag struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
 }
 
 type User struct {
@@ -13,30 +13,111 @@ import (
 	"github.com/google/uuid"
 )
 
-const createPost = `-- name: CreatePost :one
-insert into posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-values ($1, now(), now(), $2, $3, $4, $5, $6)
-returning id, created_at, updated_at, title, url, description, published_at, feed_id
+const adoptPostGUID = `-- name: AdoptPostGUID :exec
+update posts
+set updated_at = now(),
+    guid       = $1
+where posts.feed_id = $2
+  and posts.guid = $3
+  and not exists (select 1
+                  from posts existing
+                  where existing.feed_id = $2
+                    and existing.guid = $1)
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+type AdoptPostGUIDParams struct {
+	Guid         string
+	FeedID       uuid.UUID
+	FallbackGuid string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
+// Replaces the fallback guid of a post (a hash of its link and title) with the guid the feed
+// now gives it, so that posts stored before the feed gave them guids are not duplicated.
+func (q *Queries) AdoptPostGUID(ctx context.Context, arg AdoptPostGUIDParams) error {
+	_, err := q.db.ExecContext(ctx, adoptPostGUID, arg.Guid, arg.FeedID, arg.FallbackGuid)
+	return err
+}
+
+const deletePostsForFeed = `-- name: DeletePostsForFeed :exec
+delete
+from posts
+where feed_id = $1
+`
+
+func (q *Queries) DeletePostsForFeed(ctx context.Context, feedID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deletePostsForFeed, feedID)
+	return err
+}
+
+const getFallbackGUIDs = `-- name: GetFallbackGUIDs :many
+select guid
+from posts
+where feed_id = $1
+  and guid ~ '^[0-9a-f]{64}$'
+`
+
+// Returns the guids of the posts of a feed that are fallback guids (hashes of their link and
+// title), which may be replaced by guids the feed now gives them.
+func (q *Queries) GetFallbackGUIDs(ctx context.Context, feedID uuid.UUID) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getFallbackGUIDs, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var guid string
+		if err := rows.Scan(&guid); err != nil {
+			return nil, err
+		}
+		items = append(items, guid)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPost = `-- name: GetPost :one
+select id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid, content_hash, content_changed_at
+from posts
+where id = $1
+`
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Author,
+		&i.Content,
+		&i.Guid,
+		&i.ContentHash,
+		&i.ContentChangedAt,
 	)
+	return i, err
+}
+
+const getPostByURL = `-- name: GetPostByURL :one
+select id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid, content_hash, content_changed_at
+from posts
+where url = $1
+order by updated_at desc
+limit 1
+`
+
+func (q *Queries) GetPostByURL(ctx context.Context, url string) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByURL, url)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -47,10 +128,34 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Author,
+		&i.Content,
+		&i.Guid,
+		&i.ContentHash,
+		&i.ContentChangedAt,
 	)
 	return i, err
 }
 
+const getPostIDByGUID = `-- name: GetPostIDByGUID :one
+select id
+from posts
+where feed_id = $1
+  and guid = $2
+`
+
+type GetPostIDByGUIDParams struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+func (q *Queries) GetPostIDByGUID(ctx context.Context, arg GetPostIDByGUIDParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, getPostIDByGUID, arg.FeedID, arg.Guid)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
 select posts.id,
        posts.created_at,
@@ -60,33 +165,49 @@ select posts.id,
        posts.description,
        posts.published_at,
        posts.feed_id,
+       posts.author,
+       posts.content,
+       posts.guid,
+       posts.content_hash,
+       posts.content_changed_at,
        feeds.name as feed_name
 from posts
          inner join feeds on feeds.id = posts.feed_id
 where posts.feed_id in (select feed_follows.feed_id from feed_follows where feed_follows.user_id = $1)
-order by published_at desc
-limit $2
+  and ($2::text is null or exists (select 1
+                                              from post_tags
+                                                       inner join tags on tags.id = post_tags.tag_id
+                                              where post_tags.post_id = posts.id
+                                                and tags.name = $2))
+order by published_at desc nulls last
+limit $3
 `
 
 type GetPostsForUserParams struct {
 	UserID uuid.UUID
+	Tag    sql.NullString
 	Limit  int32
 }
 
 type GetPostsForUserRow struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
-	FeedName    string
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Title            string
+	Url              string
+	Description      sql.NullString
+	PublishedAt      sql.NullTime
+	FeedID           uuid.UUID
+	Author           sql.NullString
+	Content          sql.NullString
+	Guid             string
+	ContentHash      string
+	ContentChangedAt time.Time
+	FeedName         string
 }
 
 func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Tag, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +224,11 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Author,
+			&i.Content,
+			&i.Guid,
+			&i.ContentHash,
+			&i.ContentChangedAt,
 			&i.FeedName,
 		); err != nil {
 			return nil, err
@@ -117,3 +243,183 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const getRecentPublicationTimes = `-- name: GetRecentPublicationTimes :many
+select published_at
+from posts
+where feed_id = $1
+  and published_at is not null
+order by published_at desc
+limit 20
+`
+
+func (q *Queries) GetRecentPublicationTimes(ctx context.Context, feedID uuid.UUID) ([]sql.NullTime, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPublicationTimes, feedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []sql.NullTime
+	for rows.Next() {
+		var published_at sql.NullTime
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePosts = `-- name: MovePosts :exec
+update posts
+set updated_at = now(),
+    feed_id    = $1
+where posts.feed_id = $2
+  and posts.guid not in (select existing.guid
+                         from posts existing
+                         where existing.feed_id = $1)
+`
+
+type MovePostsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+// Moves the posts of one feed to another, except for posts that the other feed already has.
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
+
+const upsertPost = `-- name: UpsertPost :one
+with previous as (select posts.id,
+                         posts.updated_at,
+                         posts.title,
+                         posts.url,
+                         posts.description,
+                         posts.author,
+                         posts.content,
+                         posts.content_hash,
+                         posts.content_changed_at
+                  from posts
+                  where posts.feed_id = $1
+                    and posts.guid = $2),
+     filled as (
+         update posts
+             set updated_at   = now(),
+                 author       = $3,
+                 content      = $4,
+                 content_hash = $5
+             from previous
+             where posts.id = previous.id
+               and previous.content_hash <> $5
+               and previous.title = $6
+               and previous.url = $7
+               and previous.description is not distinct from $8
+               and (previous.author is null or previous.author = $3)
+               and (previous.content is null or previous.content = $4)
+             returning posts.id),
+     revision as (
+         insert into post_revisions (id, created_at, post_id, title, url, description, author, content, content_hash,
+                                     first_seen_at)
+             select $9,
+                    now(),
+                    previous.id,
+                    previous.title,
+                    previous.url,
+                    previous.description,
+                    previous.author,
+                    previous.content,
+                    previous.content_hash,
+                    previous.content_changed_at
+             from previous
+             where previous.content_hash <> $5
+               and not exists (select 1 from filled))
+insert
+into posts (id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid,
+            content_hash, content_changed_at)
+select $10,
+       now(),
+       now(),
+       $6,
+       $7,
+       $8,
+       $11,
+       $1,
+       $3,
+       $4,
+       $2,
+       $5,
+       now()
+where not exists (select 1 from filled)
+on conflict (feed_id, guid) do update
+    set updated_at         = now(),
+        title              = excluded.title,
+        url                = excluded.url,
+        description        = excluded.description,
+        published_at       = excluded.published_at,
+        author             = excluded.author,
+        content            = excluded.content,
+        content_hash       = excluded.content_hash,
+        content_changed_at = now()
+where posts.content_hash <> excluded.content_hash
+returning id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid, content_hash, content_changed_at
+`
+
+type UpsertPostParams struct {
+	FeedID      uuid.UUID
+	Guid        string
+	Author      sql.NullString
+	Content     sql.NullString
+	ContentHash string
+	Title       string
+	Url         string
+	Description sql.NullString
+	RevisionID  uuid.UUID
+	ID          uuid.UUID
+	PublishedAt sql.NullTime
+}
+
+// Inserts a post, or updates it if the feed already has a post with the same guid and its
+// content hash has changed, keeping the previous version as a revision. Posts stored before
+// their author and content were captured have them filled in, without a revision, if
+// nothing else has changed. Returns no rows if the post exists and is unchanged, or has only
+// been filled in.
+func (q *Queries) UpsertPost(ctx context.Context, arg UpsertPostParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, upsertPost,
+		arg.FeedID,
+		arg.Guid,
+		arg.Author,
+		arg.Content,
+		arg.ContentHash,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.RevisionID,
+		arg.ID,
+		arg.PublishedAt,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Author,
+		&i.Content,
+		&i.Guid,
+		&i.ContentHash,
+		&i.ContentChangedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"html"
+	"strconv"
+	"strings"
+)
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified"`
+	Tags          []string         `json:"tags"`
+	Author        JSONFeedAuthor   `json:"author"`
+	Authors       []JSONFeedAuthor `json:"authors"`
+
+	Attachments []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type JSONFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// toRSSFeed normalizes a JSON feed into an RSSFeed so that it can be stored in the same
+// way as an RSS feed.
+func (j *JSONFeed) toRSSFeed() *RSSFeed {
+	feed := &RSSFeed{}
+	feed.Channel.Title = j.Title
+	feed.Channel.Link = j.HomePageURL
+	feed.Channel.Description = j.Description
+	for _, item := range j.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		content := item.ContentHTML
+		if content == "" {
+			content = html.EscapeString(item.ContentText)
+		}
+		description := item.Summary
+		if description == "" {
+			description = content
+		}
+		// version 1.1 replaced author with authors, but publishers may include both
+		itemAuthors := item.Authors
+		if len(itemAuthors) == 0 {
+			itemAuthors = []JSONFeedAuthor{item.Author}
+		}
+		var authors []string
+		for _, author := range itemAuthors {
+			if author.Name != "" {
+				authors = append(authors, author.Name)
+			}
+		}
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+		var enclosures []MediaContent
+		for _, attachment := range item.Attachments {
+			enclosures = append(enclosures, MediaContent{
+				URL:      attachment.URL,
+				Type:     attachment.MimeType,
+				FileSize: formatNonZero(attachment.SizeInBytes),
+				Duration: formatNonZero(int64(attachment.DurationInSeconds)),
+			})
+		}
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:         item.ID,
+			Title:        item.Title,
+			Link:         link,
+			Description:  description,
+			PubDate:      pubDate,
+			Category:     item.Tags,
+			Author:       strings.Join(authors, ", "),
+			Content:      content,
+			MediaContent: enclosures,
+		})
+	}
+	return feed
+}
+
+// formatNonZero formats n as a decimal string, or returns an empty string if n is zero.
+func formatNonZero(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/lib/pq"
@@ -8,11 +9,15 @@ import (
 	"github.com/mattr/gator/internal/database"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 type state struct {
 	config *config.Config
 	db     *database.Queries
+	conn   *sql.DB
+	client *httpClient
 }
 
 type command struct {
@@ -21,19 +26,19 @@ type command struct {
 }
 
 type commands struct {
-	available map[string]func(*state, command) error
+	available map[string]func(context.Context, *state, command) error
 }
 
-func (c *commands) register(name string, f func(*state, command) error) {
+func (c *commands) register(name string, f func(context.Context, *state, command) error) {
 	c.available[name] = f
 }
 
-func (c *commands) run(s *state, cmd command) error {
+func (c *commands) run(ctx context.Context, s *state, cmd command) error {
 	f := c.available[cmd.name]
 	if f == nil {
 		return fmt.Errorf("command %q not found", cmd.name)
 	}
-	return f(s, cmd)
+	return f(ctx, s, cmd)
 }
 
 func registerCommands(c *commands) {
@@ -48,6 +53,13 @@ func registerCommands(c *commands) {
 	c.register("following", middlewareLoggedIn(handlerFeedFollowing))
 	c.register("unfollow", middlewareLoggedIn(handlerFeedUnfollow))
 	c.register("browse", middlewareLoggedIn(handlerBrowse))
+	c.register("tags", middlewareLoggedIn(handlerTags))
+	c.register("history", handlerHistory)
+	c.register("read", handlerRead)
+	c.register("download", middlewareLoggedIn(handlerDownload))
+	c.register("keep", handlerKeep)
+	c.register("fullarticle", handlerFullArticle)
+	c.register("enable", handlerEnable)
 }
 
 func main() {
@@ -62,9 +74,16 @@ func main() {
 	}
 	defer db.Close()
 
+	client, err := newHTTPClient(&cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	s := &state{
 		config: &cfg,
 		db:     database.New(db),
+		conn:   db,
+		client: client,
 	}
 
 	userArgs := os.Args
@@ -72,10 +91,19 @@ func main() {
 		log.Fatal("Insufficient arguments provided")
 	}
 
-	c := &commands{available: make(map[string]func(*state, command) error)}
+	// cancelled by Ctrl-C or SIGTERM, so that commands can stop cleanly; a second signal
+	// kills gator straight away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	c := &commands{available: make(map[string]func(context.Context, *state, command) error)}
 	registerCommands(c)
 	cmd := command{name: userArgs[1], args: userArgs[2:]}
-	err = c.run(s, cmd)
+	err = c.run(ctx, s, cmd)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -7,12 +7,14 @@ import (
 
 // middlewareLoggedIn provides a middleware (wrapper) function to wrap handler
 // functions where a user is required from the database.
-func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(s *state, cmd command) error {
-	return func(s *state, cmd command) error {
-		user, err := s.db.GetUserByName(context.Background(), s.config.CurrentUserName)
+func middlewareLoggedIn(
+	handler func(ctx context.Context, s *state, cmd command, user database.User) error,
+) func(ctx context.Context, s *state, cmd command) error {
+	return func(ctx context.Context, s *state, cmd command) error {
+		user, err := s.db.GetUserByName(ctx, s.config.CurrentUserName)
 		if err != nil {
 			return err
 		}
-		return handler(s, cmd, user)
+		return handler(ctx, s, cmd, user)
 	}
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// terminalWidth returns the width of the terminal, from the terminal itself or the COLUMNS
+// environment variable, defaulting to 80 columns.
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// page writes the text to standard output through the pager given by $PAGER (or less) if
+// standard output is a terminal and the pager is installed, otherwise writes it directly.
+func page(text string) error {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		_, err := fmt.Print(text)
+		return err
+	}
+
+	pager := os.Getenv("PAGER")
+	if strings.TrimSpace(pager) == "" {
+		pager = "less"
+	}
+	// print the text directly if the pager is not installed, since the shell would only
+	// report that the command was not found
+	if _, err := exec.LookPath(strings.Fields(pager)[0]); err != nil {
+		_, err = fmt.Print(text)
+		return err
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		// fall back to printing the text if the pager could not be run
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			_, err = fmt.Print(text)
+		}
+	}
+	return err
+}
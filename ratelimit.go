@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mattr/gator/internal/config"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHostDelay is the minimum time between requests to the same host when none is configured.
+const defaultHostDelay = time.Second
+
+// hostLimiter is an http.RoundTripper that spaces out requests to the same host, so that
+// fetching many feeds from one site does not overload it. A delay can be configured for a
+// domain, which then applies to it and all of its subdomains together, e.g. a delay for
+// substack.com spaces out requests to every Substack publication.
+type hostLimiter struct {
+	base         http.RoundTripper
+	defaultDelay time.Duration
+	delays       map[string]time.Duration
+
+	mu sync.Mutex
+	// next is the earliest time the next request to each host (or configured domain) may be made.
+	next map[string]time.Time
+}
+
+// newHostLimiter returns a hostLimiter with the delays in the config, making requests
+// with base.
+func newHostLimiter(cfg *config.Config, base http.RoundTripper) (*hostLimiter, error) {
+	defaultDelay, err := parseDurationOr(cfg.HostDelay, defaultHostDelay, "host_delay")
+	if err != nil {
+		return nil, err
+	}
+	limiter := &hostLimiter{
+		base:         base,
+		defaultDelay: defaultDelay,
+		delays:       make(map[string]time.Duration),
+		next:         make(map[string]time.Time),
+	}
+	for host, value := range cfg.HostDelays {
+		delay, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host_delays for %s: %w", host, err)
+		}
+		limiter.delays[strings.ToLower(strings.TrimPrefix(host, "."))] = delay
+	}
+	return limiter, nil
+}
+
+// RoundTrip waits until a request may be made to the host, then makes it.
+func (l *hostLimiter) RoundTrip(request *http.Request) (*http.Response, error) {
+	err := l.wait(request.Context(), request.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	return l.base.RoundTrip(request)
+}
+
+// wait reserves the next slot for a request to the host and waits until it arrives, or
+// the context is done.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	key, delay := l.delay(strings.ToLower(host))
+	if delay <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[key]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[key] = slot.Add(delay)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// delay returns the key the host's requests are limited under and the delay between them:
+// the most specific configured domain that the host is or is a subdomain of, or else the
+// host itself with the default delay.
+func (l *hostLimiter) delay(host string) (string, time.Duration) {
+	for domain := host; ; {
+		if delay, ok := l.delays[domain]; ok {
+			return domain, delay
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			return host, l.defaultDelay
+		}
+		domain = parent
+	}
+}
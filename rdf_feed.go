@@ -0,0 +1,49 @@
+package main
+
+// RDFFeed is an RSS 1.0 feed. Unlike RSS 2.0, the items are siblings of the channel
+// rather than children of it.
+type RDFFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		Description     string `xml:"description"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Subject     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+// toRSSFeed normalizes an RSS 1.0 feed into an RSSFeed so that it can be stored in the
+// same way as an RSS 2.0 feed.
+func (r *RDFFeed) toRSSFeed() *RSSFeed {
+	feed := &RSSFeed{}
+	feed.Channel.Title = r.Channel.Title
+	feed.Channel.Link = r.Channel.Link
+	feed.Channel.Description = r.Channel.Description
+	feed.Channel.UpdatePeriod = r.Channel.UpdatePeriod
+	feed.Channel.UpdateFrequency = r.Channel.UpdateFrequency
+	for _, item := range r.Item {
+		feed.Channel.Item = append(feed.Channel.Item, RSSItem{
+			GUID:        item.About,
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			PubDate:     item.Date,
+			Category:    item.Subject,
+			DCCreator:   item.Creator,
+			Content:     item.Content,
+		})
+	}
+	return feed
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/mattr/gator/internal/database"
+)
+
+// migrateFeed moves a feed to the URL it has permanently moved to. If another feed
+// already exists with that URL, the two are merged: the follows and posts of the
+// feed are moved to the existing feed and the feed is deleted. Returns the feed now
+// stored at the new URL, or errLeaseLost if the feed is no longer leased to the worker
+// that fetched it.
+func migrateFeed(ctx context.Context, s *state, feed database.Feed, newURL string) (database.Feed, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return feed, err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	// the lease may have expired while the feed was being fetched, and the feed been leased
+	// to another worker, which must not find it moved or deleted
+	_, err = qtx.LockLeasedFeed(ctx, database.LockLeasedFeedParams{ID: feed.ID, LeasedBy: feed.LeasedBy})
+	if errors.Is(err, sql.ErrNoRows) {
+		return feed, errLeaseLost
+	}
+	if err != nil {
+		return feed, err
+	}
+
+	target, err := qtx.GetFeedByURL(ctx, newURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		target, err = qtx.UpdateFeedURL(ctx, database.UpdateFeedURLParams{ID: feed.ID, Url: newURL})
+		if err != nil {
+			return feed, err
+		}
+		fmt.Printf("Feed %s moved permanently from %s to %s\n", feed.Name, feed.Url, newURL)
+		return target, tx.Commit()
+	}
+	if err != nil {
+		return feed, err
+	}
+
+	err = qtx.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{ToFeedID: target.ID, FromFeedID: feed.ID})
+	if err != nil {
+		return feed, err
+	}
+	err = qtx.MovePosts(ctx, database.MovePostsParams{ToFeedID: target.ID, FromFeedID: feed.ID})
+	if err != nil {
+		return feed, err
+	}
+	// any posts left are already stored against the existing feed
+	err = qtx.DeletePostsForFeed(ctx, feed.ID)
+	if err != nil {
+		return feed, err
+	}
+	err = qtx.DeleteFeed(ctx, feed.ID)
+	if err != nil {
+		return feed, err
+	}
+	fmt.Printf("Feed %s moved permanently from %s to %s, merged into existing feed %s\n",
+		feed.Name, feed.Url, newURL, target.Name)
+	return target, tx.Commit()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// textRenderer renders HTML as plain text for reading in a terminal. Paragraphs are
+// wrapped to the width of the terminal, and links are collected as numbered footnotes.
+type textRenderer struct {
+	width int
+	base  *url.URL
+	links []string
+
+	out    strings.Builder
+	inline strings.Builder
+	// prefix is written before each line of the current block, e.g. "> " in a blockquote.
+	prefix string
+	// marker replaces the prefix on the first line of the next block, e.g. a list bullet.
+	marker string
+	// blank is set when a blank line is due before the next line, and holds the prefix
+	// at the time.
+	blank *string
+	// lists is the depth of the lists being rendered.
+	lists int
+}
+
+// renderHTML renders the HTML fragment as text wrapped to width, with links resolved
+// against base and listed as footnotes at the end.
+func renderHTML(fragment string, width int, base *url.URL) string {
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return htmlToText(fragment)
+	}
+
+	r := &textRenderer{width: width, base: base}
+	for _, node := range nodes {
+		r.render(node)
+	}
+	r.flush()
+
+	text := strings.TrimRight(r.out.String(), "\n") + "\n"
+	if len(r.links) > 0 {
+		text += "\n"
+		for i, link := range r.links {
+			text += fmt.Sprintf("[%d] %s\n", i+1, link)
+		}
+	}
+	return text
+}
+
+// render renders the node and its children.
+func (r *textRenderer) render(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		r.inline.WriteString(node.Data)
+		return
+	case html.ElementNode:
+	default:
+		r.renderChildren(node)
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Iframe, atom.Noscript:
+	case atom.Br:
+		r.flush()
+	case atom.Hr:
+		r.block(func() {
+			r.inline.WriteString(strings.Repeat("-", max(r.width-utf8.RuneCountInString(r.prefix), 3)))
+		})
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.block(func() {
+			level := int(node.Data[1] - '0')
+			r.inline.WriteString(strings.Repeat("#", level) + " ")
+			r.renderChildren(node)
+		})
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Aside, atom.Figure,
+		atom.Figcaption, atom.Table, atom.Dl:
+		r.block(func() { r.renderChildren(node) })
+	case atom.Tr, atom.Dt, atom.Dd:
+		r.flush()
+		r.renderChildren(node)
+		r.flush()
+	case atom.Td, atom.Th:
+		if strings.TrimSpace(r.inline.String()) != "" {
+			r.inline.WriteString(" | ")
+		}
+		r.renderChildren(node)
+	case atom.Blockquote:
+		r.block(func() {
+			r.indent("> ", "> ", func() { r.renderChildren(node) })
+		})
+	case atom.Ul, atom.Ol:
+		if r.lists > 0 {
+			// nested lists are not separated from the item they are in
+			r.flush()
+			r.renderList(node)
+			return
+		}
+		r.block(func() { r.renderList(node) })
+	case atom.Pre:
+		r.block(func() { r.renderPre(node) })
+	case atom.Code:
+		r.inline.WriteString("`")
+		r.renderChildren(node)
+		r.inline.WriteString("`")
+	case atom.A:
+		r.renderChildren(node)
+		if href := attribute(node, "href"); href != "" && !strings.HasPrefix(href, "#") {
+			r.links = append(r.links, r.resolve(href))
+			r.inline.WriteString(fmt.Sprintf("[%d]", len(r.links)))
+		}
+	case atom.Img:
+		alt := strings.TrimSpace(attribute(node, "alt"))
+		if alt == "" {
+			alt = "image"
+		}
+		r.inline.WriteString("[" + alt + "]")
+	default:
+		r.renderChildren(node)
+	}
+}
+
+// renderChildren renders each child of the node.
+func (r *textRenderer) renderChildren(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child)
+	}
+}
+
+// renderList renders the items of a list with bullets or numbers, indenting any lines that
+// wrap to line up with the text of the item.
+func (r *textRenderer) renderList(list *html.Node) {
+	r.lists++
+	defer func() { r.lists-- }()
+	number := 1
+	for item := list.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.DataAtom != atom.Li {
+			continue
+		}
+		bullet := "* "
+		if list.DataAtom == atom.Ol {
+			bullet = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		r.flush()
+		r.indent(bullet, strings.Repeat(" ", len(bullet)), func() { r.renderChildren(item) })
+	}
+}
+
+// renderPre renders preformatted text as an indented block, without wrapping.
+func (r *textRenderer) renderPre(node *html.Node) {
+	var builder strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			builder.WriteString(n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(node)
+	for _, line := range strings.Split(strings.Trim(builder.String(), "\n"), "\n") {
+		r.writeLine(r.prefix + "    " + line)
+	}
+}
+
+// block renders a block element, separating it from the blocks around it by blank lines.
+func (r *textRenderer) block(render func()) {
+	r.flush()
+	r.blankLine()
+	render()
+	r.flush()
+	r.blankLine()
+}
+
+// indent renders with the marker before the first line and the prefix before the rest,
+// both added to the current prefix.
+func (r *textRenderer) indent(marker, prefix string, render func()) {
+	saved := r.prefix
+	r.marker = saved + marker
+	r.prefix = saved + prefix
+	render()
+	r.flush()
+	r.prefix = saved
+	r.marker = ""
+}
+
+// blankLine adds a blank line before the next line that is written, if there is any
+// output before it.
+func (r *textRenderer) blankLine() {
+	if r.out.Len() > 0 && r.blank == nil {
+		prefix := r.prefix
+		r.blank = &prefix
+	}
+}
+
+// writeLine writes a line of output, preceded by any blank line that is due. The blank
+// line keeps the part of the prefix that is common to the blocks on either side of it,
+// so that it is quoted between paragraphs of a blockquote but not around it.
+func (r *textRenderer) writeLine(line string) {
+	if r.blank != nil {
+		common := 0
+		for common < len(*r.blank) && common < len(r.prefix) && (*r.blank)[common] == r.prefix[common] {
+			common++
+		}
+		r.out.WriteString(strings.TrimRight(r.prefix[:common], " ") + "\n")
+		r.blank = nil
+	}
+	r.out.WriteString(strings.TrimRight(line, " ") + "\n")
+}
+
+// flush wraps the pending inline text to the width of the terminal and writes it.
+func (r *textRenderer) flush() {
+	words := strings.Fields(r.inline.String())
+	r.inline.Reset()
+	if len(words) == 0 {
+		return
+	}
+
+	prefix := r.prefix
+	if r.marker != "" {
+		prefix = r.marker
+		r.marker = ""
+	}
+	available := max(r.width-utf8.RuneCountInString(r.prefix), 20)
+	line := ""
+	for _, word := range words {
+		if line != "" && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > available {
+			r.writeLine(prefix + line)
+			prefix = r.prefix
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	r.writeLine(prefix + line)
+}
+
+// resolve resolves a link against the base URL of the post.
+func (r *textRenderer) resolve(href string) string {
+	link, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || r.base == nil {
+		return href
+	}
+	return r.base.ResolveReference(link).String()
+}
+
+// attribute returns the value of the named attribute of the node, or an empty string.
+func attribute(node *html.Node, name string) string {
+	for _, a := range node.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
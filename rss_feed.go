@@ -1,17 +1,101 @@
 package main
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
 type RSSFeed struct {
 	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Item        []RSSItem `xml:"item"`
+		Title       string   `xml:"title"`
+		Link        string   `xml:"link"`
+		Description string   `xml:"description"`
+		TTL         string   `xml:"ttl"`
+		SkipHours   []string `xml:"skipHours>hour"`
+		SkipDays    []string `xml:"skipDays>day"`
+		// UpdatePeriod and UpdateFrequency are from the syndication module, e.g. a period of
+		// "hourly" and frequency of 2 means the feed is updated every half an hour.
+		UpdatePeriod    string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string    `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		Item            []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	GUID        string   `xml:"guid"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	DCDate      string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Category    []string `xml:"category"`
+	Author      string   `xml:"author"`
+	DCCreator   string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+
+	Enclosure      []RSSEnclosure `xml:"enclosure"`
+	MediaContent   []MediaContent `xml:"http://search.yahoo.com/mrss/ content"`
+	ITunesDuration string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesEpisode  string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ITunesSeason   string         `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesImage    ITunesImage    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// MediaContent is a media:content element from the Media RSS namespace.
+type MediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	FileSize string `xml:"fileSize,attr"`
+	Duration string `xml:"duration,attr"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// author returns the author of the item from its dc:creator element, or failing that, its
+// author element. RSS authors are email addresses, optionally followed by the name of the
+// author in brackets, in which case only the name is returned.
+func (item RSSItem) author() string {
+	if creator := strings.TrimSpace(item.DCCreator); creator != "" {
+		return creator
+	}
+	author := strings.TrimSpace(item.Author)
+	if open := strings.Index(author, "("); open > 0 && strings.HasSuffix(author, ")") {
+		return strings.TrimSpace(author[open+1 : len(author)-1])
+	}
+	return author
+}
+
+// guid returns the identity of the item within its feed: its guid element (or the Atom id
+// or JSON feed id it was normalized from), falling back to a hash of its link and title.
+func (item RSSItem) guid() string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return guid
+	}
+	return item.fallbackGUID()
+}
+
+// hasGUIDs reports whether any item in the feed has a guid of its own.
+func (feed *RSSFeed) hasGUIDs() bool {
+	for _, item := range feed.Channel.Item {
+		if strings.TrimSpace(item.GUID) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackGUID returns a hash of the link and title of the item, used as its identity when
+// the feed does not give it a guid.
+func (item RSSItem) fallbackGUID() string {
+	sum := sha256.Sum256([]byte(item.Link + "\n" + item.Title))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/mattr/gator/internal/database"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMinFetchInterval is the shortest time between fetches of a feed when none is configured.
+	defaultMinFetchInterval = 15 * time.Minute
+	// defaultMaxFetchInterval is the longest time between fetches of a feed when none is configured.
+	defaultMaxFetchInterval = 24 * time.Hour
+	// maxBackoff limits the number of times the interval is doubled for a feed that has not changed.
+	maxBackoff = 10
+)
+
+// updatePeriods are the values of sy:updatePeriod understood by hintedInterval.
+var updatePeriods = []string{"hourly", "daily", "weekly", "monthly", "yearly"}
+
+// weekdays are the days of the week as given in <skipDays>.
+var weekdays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+// updateHintsParams returns the parameters to store the hints the publisher gives about
+// how often the feed should be fetched: the <ttl> in minutes, the hours (GMT) and days
+// in <skipHours> and <skipDays>, and the syndication module's update period and frequency.
+// Values that are not valid are ignored.
+func (feed *RSSFeed) updateHintsParams(feedID uuid.UUID) database.SetFeedUpdateHintsParams {
+	params := database.SetFeedUpdateHintsParams{
+		ID:        feedID,
+		SkipHours: []int32{},
+		SkipDays:  []string{},
+	}
+
+	if ttl := parseNullInt32(feed.Channel.TTL); ttl.Valid && ttl.Int32 > 0 {
+		params.Ttl = ttl
+	}
+
+	for _, value := range feed.Channel.SkipHours {
+		hour, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || hour < 0 || hour > 24 {
+			continue
+		}
+		// some publishers number the hours 1-24 rather than 0-23
+		hour %= 24
+		if !slices.Contains(params.SkipHours, int32(hour)) {
+			params.SkipHours = append(params.SkipHours, int32(hour))
+		}
+	}
+
+	for _, value := range feed.Channel.SkipDays {
+		for _, day := range weekdays {
+			if strings.EqualFold(strings.TrimSpace(value), day) && !slices.Contains(params.SkipDays, day) {
+				params.SkipDays = append(params.SkipDays, day)
+			}
+		}
+	}
+	// a feed that skips every hour or every day would never be fetched again
+	if len(params.SkipHours) == 24 {
+		params.SkipHours = []int32{}
+	}
+	if len(params.SkipDays) == len(weekdays) {
+		params.SkipDays = []string{}
+	}
+
+	period := strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod))
+	if slices.Contains(updatePeriods, period) {
+		params.UpdatePeriod = nullString(period)
+		if frequency := parseNullInt32(feed.Channel.UpdateFrequency); frequency.Valid && frequency.Int32 > 0 {
+			params.UpdateFrequency = frequency
+		}
+	}
+	return params
+}
+
+// fetchIntervalBounds returns the configured shortest and longest time between fetches of
+// a feed, or the defaults if they are not configured.
+func fetchIntervalBounds(s *state) (time.Duration, time.Duration, error) {
+	minInterval, err := parseDurationOr(s.config.MinFetchInterval, defaultMinFetchInterval, "min_fetch_interval")
+	if err != nil {
+		return 0, 0, err
+	}
+	maxInterval, err := parseDurationOr(s.config.MaxFetchInterval, defaultMaxFetchInterval, "max_fetch_interval")
+	if err != nil {
+		return 0, 0, err
+	}
+	if maxInterval < minInterval {
+		return 0, 0, fmt.Errorf("max_fetch_interval %s is shorter than min_fetch_interval %s", maxInterval, minInterval)
+	}
+	return minInterval, maxInterval, nil
+}
+
+// hintedInterval returns the shortest time between fetches that the publisher asks for with
+// the <ttl> and syndication update period of the feed, or 0 if there are no hints.
+func hintedInterval(feed database.Feed) time.Duration {
+	var interval time.Duration
+	if feed.Ttl.Valid {
+		interval = time.Duration(feed.Ttl.Int32) * time.Minute
+	}
+	if feed.UpdatePeriod.Valid {
+		var period time.Duration
+		switch feed.UpdatePeriod.String {
+		case "hourly":
+			period = time.Hour
+		case "daily":
+			period = 24 * time.Hour
+		case "weekly":
+			period = 7 * 24 * time.Hour
+		case "monthly":
+			period = 30 * 24 * time.Hour
+		case "yearly":
+			period = 365 * 24 * time.Hour
+		}
+		if feed.UpdateFrequency.Valid && feed.UpdateFrequency.Int32 > 0 {
+			period /= time.Duration(feed.UpdateFrequency.Int32)
+		}
+		interval = max(interval, period)
+	}
+	return interval
+}
+
+// postingInterval returns the average time between the posts published at the given times,
+// most recent first, or 0 if there are too few to tell.
+func postingInterval(times []sql.NullTime) time.Duration {
+	if len(times) < 2 {
+		return 0
+	}
+	return times[0].Time.Sub(times[len(times)-1].Time) / time.Duration(len(times)-1)
+}
+
+// scheduleFeed sets when the feed is next due to be fetched. The interval is the average
+// time between its recent posts, doubled for each fetch in a row that found nothing new or
+// changed, and kept within the configured bounds. The publisher's hints take precedence
+// over the longest interval, as fetching more often than they ask is pointless. A feed that
+// failed to be fetched is retried after the shortest interval, doubled for each failure in
+// a row.
+//
+// wait is the time the server asked for: how long the feed remains fresh after a successful
+// fetch, which the interval is extended to, or its Retry-After after a failure, which
+// replaces the interval. Either is limited to the longest interval.
+func scheduleFeed(ctx context.Context, s *state, feed database.Feed, changed bool, wait time.Duration) error {
+	minInterval, maxInterval, err := fetchIntervalBounds(s)
+	if err != nil {
+		return err
+	}
+	times, err := s.db.GetRecentPublicationTimes(ctx, feed.ID)
+	if err != nil {
+		return err
+	}
+
+	unchanged := int32(0)
+	if !changed {
+		unchanged = feed.UnchangedFetches + 1
+	}
+	interval := min(max(postingInterval(times), minInterval), maxInterval)
+	backoff := unchanged
+	if feed.ConsecutiveFailures > 0 {
+		// retry a feed that could not be fetched sooner, backing off with each failure in a row
+		unchanged = feed.UnchangedFetches
+		interval = minInterval
+		backoff = feed.ConsecutiveFailures - 1
+	}
+	for range min(backoff, maxBackoff) {
+		interval = min(interval*2, maxInterval)
+	}
+	interval = max(interval, hintedInterval(feed))
+	if wait > 0 {
+		wait = min(wait, maxInterval)
+		if feed.ConsecutiveFailures > 0 {
+			// wait exactly as long as the server asked before trying again
+			interval = wait
+		} else {
+			interval = max(interval, wait)
+		}
+	}
+
+	fmt.Printf("Next fetch of %s in %s\n", feed.Name, interval.Round(time.Second))
+	return s.db.ScheduleFeed(ctx, database.ScheduleFeedParams{
+		IntervalSeconds:  int32(interval / time.Second),
+		UnchangedFetches: unchanged,
+		ID:               feed.ID,
+		LeasedBy:         feed.LeasedBy,
+	})
+}
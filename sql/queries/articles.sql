@@ -0,0 +1,12 @@
+-- name: UpsertArticle :exec
+insert into articles (post_id, created_at, updated_at, url, content)
+values ($1, now(), now(), $2, $3)
+on conflict (post_id) do update
+    set updated_at = now(),
+        url        = excluded.url,
+        content    = excluded.content;
+
+-- name: GetArticleForPost :one
+select post_id, created_at, updated_at, url, content
+from articles
+where post_id = $1;
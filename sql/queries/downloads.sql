@@ -0,0 +1,60 @@
+-- name: CreateDownload :one
+insert into downloads (id, created_at, updated_at, enclosure_id, path, size)
+values ($1, now(), now(), $2, $3, $4)
+returning id, created_at, updated_at, enclosure_id, path, size, deleted_at;
+
+-- name: DownloadPathInUse :one
+select exists (select 1
+               from downloads
+               where path = $1
+                 and deleted_at is null);
+
+-- Returns the audio and video enclosures of posts in the feeds the user follows that have
+-- not been downloaded yet, limited to the most recent posts of feeds with a keep policy.
+-- name: GetPendingDownloads :many
+select ranked.id, ranked.url, ranked.mime_type, ranked.post_id, ranked.post_title, ranked.published_at, ranked.feed_name
+from (select enclosures.id,
+             enclosures.url,
+             enclosures.mime_type,
+             enclosures.created_at,
+             posts.id    as post_id,
+             posts.title as post_title,
+             posts.published_at,
+             feeds.name  as feed_name,
+             feeds.download_keep,
+             dense_rank() over (partition by feeds.id order by posts.published_at desc nulls last, posts.id) as recency
+      from enclosures
+               inner join posts on posts.id = enclosures.post_id
+               inner join feeds on feeds.id = posts.feed_id
+      where feeds.id in (select feed_follows.feed_id from feed_follows where feed_follows.user_id = $1)
+        and (enclosures.mime_type is null
+          or enclosures.mime_type like 'audio/%'
+          or enclosures.mime_type like 'video/%')) ranked
+where (ranked.download_keep is null or ranked.recency <= ranked.download_keep)
+  and not exists (select 1
+                  from downloads
+                           inner join enclosures downloaded on downloaded.id = downloads.enclosure_id
+                  where downloaded.post_id = ranked.post_id)
+order by ranked.published_at desc nulls last, ranked.post_id, ranked.created_at;
+
+-- Returns the downloads that are no longer among the most recent posts of feeds with a
+-- keep policy.
+-- name: GetExpiredDownloads :many
+select ranked.id, ranked.path
+from (select downloads.id,
+             downloads.path,
+             feeds.download_keep,
+             row_number() over (partition by feeds.id order by posts.published_at desc nulls last, downloads.created_at desc) as recency
+      from downloads
+               inner join enclosures on enclosures.id = downloads.enclosure_id
+               inner join posts on posts.id = enclosures.post_id
+               inner join feeds on feeds.id = posts.feed_id
+      where downloads.deleted_at is null) ranked
+where ranked.download_keep is not null
+  and ranked.recency > ranked.download_keep;
+
+-- name: MarkDownloadDeleted :exec
+update downloads
+set updated_at = now(),
+    deleted_at = now()
+where id = $1;
@@ -0,0 +1,11 @@
+-- name: CreateEnclosure :exec
+insert into enclosures (id, created_at, updated_at, post_id, url, mime_type, length, duration_seconds, episode, season,
+                        image_url)
+values ($1, now(), now(), $2, $3, $4, $5, $6, $7, $8, $9)
+on conflict (post_id, url) do nothing;
+
+-- name: GetEnclosuresForPost :many
+select id, created_at, updated_at, post_id, url, mime_type, length, duration_seconds, episode, season, image_url
+from enclosures
+where post_id = $1
+order by created_at;
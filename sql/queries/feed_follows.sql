@@ -14,4 +14,13 @@ from inserted_feed_follow
 delete
 from feed_follows
 where feed_follows.user_id = $1
-  and feed_follows.feed_id = (select feeds.id from feeds where feeds.url = $2);
\ No newline at end of file
+  and feed_follows.feed_id = (select feeds.id from feeds where feeds.url = $2);
+
+-- name: MoveFeedFollows :exec
+update feed_follows
+set updated_at = now(),
+    feed_id    = sqlc.arg(to_feed_id)
+where feed_follows.feed_id = sqlc.arg(from_feed_id)
+  and feed_follows.user_id not in (select existing.user_id
+                                   from feed_follows existing
+                                   where existing.feed_id = sqlc.arg(to_feed_id));
@@ -1,33 +1,169 @@
 -- name: CreateFeed :one
 insert into feeds(id, created_at, updated_at, name, url, user_id)
 values ($1, now(), now(), $2, $3, $4)
-returning id, created_at, updated_at, name, url, user_id, last_fetched_at;
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by;
 
 -- name: GetFeeds :many
-select id, created_at, updated_at, name, url, user_id, last_fetched_at
+select id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 from feeds;
 
 -- name: GetFeedByURL :one
-select id, created_at, updated_at, name, url, user_id, last_fetched_at
+select id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 from feeds
 where url = $1;
 
 -- name: GetFeedsForUser :many
-select feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at
+select feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.download_keep, feeds.fetch_full_article, feeds.ttl, feeds.skip_hours, feeds.skip_days, feeds.update_period, feeds.update_frequency, feeds.next_fetch_at, feeds.unchanged_fetches, feeds.last_error, feeds.last_status, feeds.consecutive_failures, feeds.disabled_at, feeds.leased_by, feeds.lease_expires_at, feeds.last_fetched_by
 from feeds
          inner join feed_follows on feed_follows.feed_id = feeds.id
          inner join users on users.id = feed_follows.user_id
 where users.id = $1;
 
+-- Records a successful fetch of a feed by the worker holding the lease on it.
 -- name: MarkFeedFetched :one
 update feeds
-set updated_at      = now(),
-    last_fetched_at = now()
+set updated_at           = now(),
+    last_fetched_at      = now(),
+    last_status          = $2,
+    last_error           = null,
+    consecutive_failures = 0,
+    last_fetched_by      = $3
 where id = $1
-returning id, created_at, updated_at, name, url, user_id, last_fetched_at;
+  and leased_by = $4
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by;
 
--- name: GetNextFeedToFetch :one
-select id, created_at, updated_at, name, url, user_id, last_fetched_at
+-- Leases the feeds that are due to be fetched to a worker, so that other workers (in this or
+-- another process) do not fetch them too. A feed is due once its next fetch time has passed,
+-- unless the current hour or day (in GMT) is one the publisher asks to be skipped, and is not
+-- leased unless the lease has expired, e.g. because the worker holding it crashed.
+-- name: ClaimDueFeeds :many
+with due as (select feeds.id
+             from feeds
+             where feeds.disabled_at is null
+               and (feeds.next_fetch_at is null or feeds.next_fetch_at <= now())
+               and (feeds.lease_expires_at is null or feeds.lease_expires_at <= now())
+               and not extract(hour from now() at time zone 'UTC')::integer = any (feeds.skip_hours)
+               and not to_char(now() at time zone 'UTC', 'FMDay') = any (feeds.skip_days)
+             order by feeds.next_fetch_at asc nulls first, feeds.last_fetched_at asc nulls first
+             limit sqlc.arg('limit') for update skip locked)
+update feeds
+set leased_by        = sqlc.arg(worker),
+    lease_expires_at = now() + sqlc.arg(lease_seconds)::integer * interval '1 second'
+from due
+where feeds.id = due.id
+returning feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.download_keep, feeds.fetch_full_article, feeds.ttl, feeds.skip_hours, feeds.skip_days, feeds.update_period, feeds.update_frequency, feeds.next_fetch_at, feeds.unchanged_fetches, feeds.last_error, feeds.last_status, feeds.consecutive_failures, feeds.disabled_at, feeds.leased_by, feeds.lease_expires_at, feeds.last_fetched_by;
+
+-- Locks a feed for the rest of the transaction, if it is still leased to the given worker.
+-- name: LockLeasedFeed :one
+select id
+from feeds
+where id = $1
+  and leased_by = $2
+    for update;
+
+-- name: UpdateFeedURL :one
+update feeds
+set updated_at = now(),
+    url        = $2
+where id = $1
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by;
+
+-- name: DeleteFeed :exec
+delete
+from feeds
+where id = $1;
+
+-- name: SetFeedDownloadKeep :exec
+update feeds
+set updated_at    = now(),
+    download_keep = $2
+where id = $1;
+
+-- name: SetFeedFetchFullArticle :exec
+update feeds
+set updated_at         = now(),
+    fetch_full_article = $2
+where id = $1;
+
+-- Stores the hints the publisher gives about how often to fetch the feed, if it is still
+-- leased to the given worker.
+-- name: SetFeedUpdateHints :one
+update feeds
+set updated_at       = now(),
+    ttl              = $2,
+    skip_hours       = $3,
+    skip_days        = $4,
+    update_period    = $5,
+    update_frequency = $6
+where id = $1
+  and leased_by = $7
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by;
+
+-- Sets when the feed is next due to be fetched, releasing the lease on it, unless the lease
+-- has expired and been taken by another worker.
+-- name: ScheduleFeed :exec
+update feeds
+set updated_at        = now(),
+    next_fetch_at     = now() + sqlc.arg(interval_seconds)::integer * interval '1 second',
+    unchanged_fetches = sqlc.arg(unchanged_fetches),
+    leased_by         = null,
+    lease_expires_at  = null
+where id = sqlc.arg(id)
+  and leased_by = sqlc.arg(leased_by);
+
+-- Stores the cache validators of a feed, once every post in the response they came with has
+-- been stored, so that posts that failed to be stored are fetched again.
+-- name: SetFeedCacheValidators :exec
+update feeds
+set updated_at    = now(),
+    etag          = $2,
+    last_modified = $3
+where id = $1
+  and leased_by = $4;
+
+-- Records a failed fetch of a feed, disabling it once it has failed the given number of times
+-- in a row. A feed that is being rate limited is not broken, so the failure is not counted.
+-- Only the worker holding the lease on the feed can record a failure.
+-- name: MarkFeedFailed :one
+update feeds
+set updated_at           = now(),
+    last_fetched_at      = now(),
+    last_status          = sqlc.narg(last_status),
+    last_error           = sqlc.arg(last_error),
+    last_fetched_by      = sqlc.arg(worker),
+    consecutive_failures = case
+                               when sqlc.arg(rate_limited)::boolean then consecutive_failures
+                               else consecutive_failures + 1
+                               end,
+    disabled_at          = case
+                               when not sqlc.arg(rate_limited)::boolean
+                                   and consecutive_failures + 1 >= sqlc.arg(failure_threshold)::integer then now()
+                               end
+where id = sqlc.arg(id)
+  and leased_by = sqlc.arg(leased_by)
+returning id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by;
+
+-- name: GetBrokenFeeds :many
+select id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, download_keep, fetch_full_article, ttl, skip_hours, skip_days, update_period, update_frequency, next_fetch_at, unchanged_fetches, last_error, last_status, consecutive_failures, disabled_at, leased_by, lease_expires_at, last_fetched_by
 from feeds
-order by last_fetched_at asc nulls first
-limit 1;
+where consecutive_failures > 0
+   or disabled_at is not null
+order by disabled_at asc nulls last, consecutive_failures desc;
+
+-- name: EnableFeed :exec
+update feeds
+set updated_at           = now(),
+    disabled_at          = null,
+    consecutive_failures = 0,
+    next_fetch_at        = null,
+    leased_by            = null,
+    lease_expires_at     = null
+where id = $1;
+
+-- Releases a lease on a feed without fetching it, so that another worker can fetch it.
+-- name: ReleaseFeedLease :exec
+update feeds
+set leased_by        = null,
+    lease_expires_at = null
+where id = sqlc.arg(id)
+  and leased_by = sqlc.arg(worker);
@@ -0,0 +1,5 @@
+-- name: GetPostRevisions :many
+select id, created_at, post_id, title, url, description, author, content, content_hash, first_seen_at
+from post_revisions
+where post_id = $1
+order by created_at;
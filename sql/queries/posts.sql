@@ -1,7 +1,99 @@
--- name: CreatePost :one
-insert into posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-values ($1, now(), now(), $2, $3, $4, $5, $6)
-returning id, created_at, updated_at, title, url, description, published_at, feed_id;
+-- Inserts a post, or updates it if the feed already has a post with the same guid and its
+-- content hash has changed, keeping the previous version as a revision. Posts stored before
+-- their author and content were captured have them filled in, without a revision, if
+-- nothing else has changed. Returns no rows if the post exists and is unchanged, or has only
+-- been filled in.
+-- name: UpsertPost :one
+with previous as (select posts.id,
+                         posts.updated_at,
+                         posts.title,
+                         posts.url,
+                         posts.description,
+                         posts.author,
+                         posts.content,
+                         posts.content_hash,
+                         posts.content_changed_at
+                  from posts
+                  where posts.feed_id = sqlc.arg(feed_id)
+                    and posts.guid = sqlc.arg(guid)),
+     filled as (
+         update posts
+             set updated_at   = now(),
+                 author       = sqlc.arg(author),
+                 content      = sqlc.arg(content),
+                 content_hash = sqlc.arg(content_hash)
+             from previous
+             where posts.id = previous.id
+               and previous.content_hash <> sqlc.arg(content_hash)
+               and previous.title = sqlc.arg(title)
+               and previous.url = sqlc.arg(url)
+               and previous.description is not distinct from sqlc.arg(description)
+               and (previous.author is null or previous.author = sqlc.arg(author))
+               and (previous.content is null or previous.content = sqlc.arg(content))
+             returning posts.id),
+     revision as (
+         insert into post_revisions (id, created_at, post_id, title, url, description, author, content, content_hash,
+                                     first_seen_at)
+             select sqlc.arg(revision_id),
+                    now(),
+                    previous.id,
+                    previous.title,
+                    previous.url,
+                    previous.description,
+                    previous.author,
+                    previous.content,
+                    previous.content_hash,
+                    previous.content_changed_at
+             from previous
+             where previous.content_hash <> sqlc.arg(content_hash)
+               and not exists (select 1 from filled))
+insert
+into posts (id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid,
+            content_hash, content_changed_at)
+select sqlc.arg(id),
+       now(),
+       now(),
+       sqlc.arg(title),
+       sqlc.arg(url),
+       sqlc.arg(description),
+       sqlc.arg(published_at),
+       sqlc.arg(feed_id),
+       sqlc.arg(author),
+       sqlc.arg(content),
+       sqlc.arg(guid),
+       sqlc.arg(content_hash),
+       now()
+where not exists (select 1 from filled)
+on conflict (feed_id, guid) do update
+    set updated_at         = now(),
+        title              = excluded.title,
+        url                = excluded.url,
+        description        = excluded.description,
+        published_at       = excluded.published_at,
+        author             = excluded.author,
+        content            = excluded.content,
+        content_hash       = excluded.content_hash,
+        content_changed_at = now()
+where posts.content_hash <> excluded.content_hash
+returning id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid, content_hash, content_changed_at;
+
+-- name: GetPost :one
+select id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid, content_hash, content_changed_at
+from posts
+where id = $1;
+
+-- name: GetPostByURL :one
+select id, created_at, updated_at, title, url, description, published_at, feed_id, author, content, guid, content_hash, content_changed_at
+from posts
+where url = $1
+order by updated_at desc
+limit 1;
+
+-- name: GetPostIDByGUID :one
+select id
+from posts
+where feed_id = $1
+  and guid = $2;
 
 -- name: GetPostsForUser :many
 select posts.id,
@@ -12,9 +104,63 @@ select posts.id,
        posts.description,
        posts.published_at,
        posts.feed_id,
+       posts.author,
+       posts.content,
+       posts.guid,
+       posts.content_hash,
+       posts.content_changed_at,
        feeds.name as feed_name
 from posts
          inner join feeds on feeds.id = posts.feed_id
-where posts.feed_id in (select feed_follows.feed_id from feed_follows where feed_follows.user_id = $1)
+where posts.feed_id in (select feed_follows.feed_id from feed_follows where feed_follows.user_id = sqlc.arg(user_id))
+  and (sqlc.narg(tag)::text is null or exists (select 1
+                                              from post_tags
+                                                       inner join tags on tags.id = post_tags.tag_id
+                                              where post_tags.post_id = posts.id
+                                                and tags.name = sqlc.narg(tag)))
+order by published_at desc nulls last
+limit sqlc.arg('limit');
+
+-- Moves the posts of one feed to another, except for posts that the other feed already has.
+-- name: MovePosts :exec
+update posts
+set updated_at = now(),
+    feed_id    = sqlc.arg(to_feed_id)
+where posts.feed_id = sqlc.arg(from_feed_id)
+  and posts.guid not in (select existing.guid
+                         from posts existing
+                         where existing.feed_id = sqlc.arg(to_feed_id));
+
+-- name: DeletePostsForFeed :exec
+delete
+from posts
+where feed_id = $1;
+
+-- Replaces the fallback guid of a post (a hash of its link and title) with the guid the feed
+-- now gives it, so that posts stored before the feed gave them guids are not duplicated.
+-- name: AdoptPostGUID :exec
+update posts
+set updated_at = now(),
+    guid       = sqlc.arg(guid)
+where posts.feed_id = sqlc.arg(feed_id)
+  and posts.guid = sqlc.arg(fallback_guid)
+  and not exists (select 1
+                  from posts existing
+                  where existing.feed_id = sqlc.arg(feed_id)
+                    and existing.guid = sqlc.arg(guid));
+
+-- Returns the guids of the posts of a feed that are fallback guids (hashes of their link and
+-- title), which may be replaced by guids the feed now gives them.
+-- name: GetFallbackGUIDs :many
+select guid
+from posts
+where feed_id = $1
+  and guid ~ '^[0-9a-f]{64}$';
+
+-- name: GetRecentPublicationTimes :many
+select published_at
+from posts
+where feed_id = $1
+  and published_at is not null
 order by published_at desc
-limit $2;
+limit 20;
@@ -0,0 +1,20 @@
+-- name: UpsertTag :one
+insert into tags (id, created_at, updated_at, name)
+values ($1, now(), now(), $2)
+on conflict (name) do update set updated_at = now()
+returning id, created_at, updated_at, name;
+
+-- name: CreatePostTag :exec
+insert into post_tags (post_id, tag_id)
+values ($1, $2)
+on conflict do nothing;
+
+-- name: GetTagsForUser :many
+select tags.name, count(*) as post_count
+from tags
+         inner join post_tags on post_tags.tag_id = tags.id
+         inner join posts on posts.id = post_tags.post_id
+where posts.feed_id in (select feed_follows.feed_id from feed_follows where feed_follows.user_id = $1)
+group by tags.name
+order by post_count desc, tags.name
+limit $2;
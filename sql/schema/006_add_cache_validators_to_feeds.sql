@@ -0,0 +1,9 @@
+-- +goose Up
+alter table feeds
+    add column etag          text,
+    add column last_modified text;
+
+-- +goose Down
+alter table feeds
+    drop column etag,
+    drop column last_modified;
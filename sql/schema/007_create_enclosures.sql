@@ -0,0 +1,18 @@
+-- +goose Up
+create table enclosures (
+    id               uuid primary key,
+    created_at       timestamp not null,
+    updated_at       timestamp not null,
+    post_id          uuid      not null references posts on delete cascade,
+    url              text      not null,
+    mime_type        text,
+    length           bigint,
+    duration_seconds integer,
+    episode          integer,
+    season           integer,
+    image_url        text,
+    unique (post_id, url)
+);
+
+-- +goose Down
+drop table enclosures;
@@ -0,0 +1,19 @@
+-- +goose Up
+alter table feeds
+    add column download_keep integer;
+
+create table downloads (
+    id           uuid primary key,
+    created_at   timestamp not null,
+    updated_at   timestamp not null,
+    enclosure_id uuid      not null unique references enclosures on delete cascade,
+    path         text      not null,
+    size         bigint    not null,
+    deleted_at   timestamp
+);
+
+-- +goose Down
+drop table downloads;
+
+alter table feeds
+    drop column download_keep;
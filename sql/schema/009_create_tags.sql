@@ -0,0 +1,17 @@
+-- +goose Up
+create table tags (
+    id         uuid primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    name       text      not null unique
+);
+
+create table post_tags (
+    post_id uuid not null references posts on delete cascade,
+    tag_id  uuid not null references tags on delete cascade,
+    primary key (post_id, tag_id)
+);
+
+-- +goose Down
+drop table post_tags;
+drop table tags;
@@ -0,0 +1,9 @@
+-- +goose Up
+alter table posts
+    add column author  text,
+    add column content text;
+
+-- +goose Down
+alter table posts
+    drop column author,
+    drop column content;
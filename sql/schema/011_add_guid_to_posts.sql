@@ -0,0 +1,19 @@
+-- +goose Up
+alter table posts
+    add column guid text;
+
+-- existing posts are given the fallback guid used for items without a guid: a hash of
+-- the link and title
+update posts
+set guid = encode(sha256(convert_to(url || E'\n' || title, 'UTF8')), 'hex');
+
+alter table posts
+    alter column guid set not null,
+    drop constraint posts_url_key,
+    add constraint posts_feed_id_guid_key unique (feed_id, guid);
+
+-- +goose Down
+alter table posts
+    drop constraint posts_feed_id_guid_key,
+    drop column guid,
+    add constraint posts_url_key unique (url);
@@ -0,0 +1,32 @@
+-- +goose Up
+alter table posts
+    add column content_hash text;
+
+-- must match contentHash in gator
+update posts
+set content_hash = encode(sha256(convert_to(title || E'\n' || url || E'\n' || coalesce(author, '') || E'\n' ||
+                                            coalesce(description, '') || E'\n' || coalesce(content, ''), 'UTF8')),
+                          'hex');
+
+alter table posts
+    alter column content_hash set not null;
+
+create table post_revisions (
+    id            uuid primary key,
+    created_at    timestamp not null,
+    post_id       uuid      not null references posts on delete cascade,
+    title         text      not null,
+    url           text      not null,
+    description   text,
+    author        text,
+    content       text,
+    content_hash  text      not null,
+    first_seen_at timestamp not null
+);
+create index post_revisions_post_id_idx on post_revisions (post_id);
+
+-- +goose Down
+drop table post_revisions;
+
+alter table posts
+    drop column content_hash;
@@ -0,0 +1,17 @@
+-- +goose Up
+alter table feeds
+    add column fetch_full_article boolean not null default false;
+
+create table articles (
+    post_id    uuid primary key references posts on delete cascade,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    url        text      not null,
+    content    text      not null
+);
+
+-- +goose Down
+drop table articles;
+
+alter table feeds
+    drop column fetch_full_article;
@@ -0,0 +1,15 @@
+-- +goose Up
+alter table feeds
+    add column ttl              integer,
+    add column skip_hours       integer[] not null default '{}',
+    add column skip_days        text[]    not null default '{}',
+    add column update_period    text,
+    add column update_frequency integer;
+
+-- +goose Down
+alter table feeds
+    drop column ttl,
+    drop column skip_hours,
+    drop column skip_days,
+    drop column update_period,
+    drop column update_frequency;
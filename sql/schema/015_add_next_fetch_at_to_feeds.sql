@@ -0,0 +1,9 @@
+-- +goose Up
+alter table feeds
+    add column next_fetch_at     timestamp,
+    add column unchanged_fetches integer not null default 0;
+
+-- +goose Down
+alter table feeds
+    drop column next_fetch_at,
+    drop column unchanged_fetches;
@@ -0,0 +1,13 @@
+-- +goose Up
+alter table feeds
+    add column last_error           text,
+    add column last_status          integer,
+    add column consecutive_failures integer not null default 0,
+    add column disabled_at          timestamp;
+
+-- +goose Down
+alter table feeds
+    drop column last_error,
+    drop column last_status,
+    drop column consecutive_failures,
+    drop column disabled_at;
@@ -0,0 +1,11 @@
+-- +goose Up
+alter table feeds
+    add column leased_by        text,
+    add column lease_expires_at timestamp,
+    add column last_fetched_by  text;
+
+-- +goose Down
+alter table feeds
+    drop column leased_by,
+    drop column lease_expires_at,
+    drop column last_fetched_by;
@@ -0,0 +1,14 @@
+-- +goose Up
+alter table posts
+    add column content_changed_at timestamp;
+
+-- updated_at is the best record of when the content of existing posts last changed
+update posts
+set content_changed_at = updated_at;
+
+alter table posts
+    alter column content_changed_at set not null;
+
+-- +goose Down
+alter table posts
+    drop column content_changed_at;
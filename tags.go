@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/mattr/gator/internal/database"
+	"strings"
+)
+
+// normalizeTag returns the canonical form of a tag name, lowercased with surrounding and
+// repeated whitespace removed, so that "Go", "go " and "GO" are stored as one tag.
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// tags returns the normalized, de-duplicated categories of the item.
+func (item RSSItem) tags() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, category := range item.Category {
+		tag := normalizeTag(category)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// storeTags links the post to each of the named tags, creating any tags that do not
+// already exist.
+func storeTags(ctx context.Context, s *state, postID uuid.UUID, names []string) error {
+	for _, name := range names {
+		tag, err := s.db.UpsertTag(ctx, database.UpsertTagParams{ID: uuid.New(), Name: name})
+		if err != nil {
+			return err
+		}
+		err = s.db.CreatePostTag(ctx, database.CreatePostTagParams{PostID: postID, TagID: tag.ID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,49 +3,115 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/xml"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/mattr/gator/internal/database"
-	"html"
-	"io"
 	"net/http"
 	"time"
 )
 
-// fetchFeed fetches the feed from the provided URL and creates a new RSSFeed object
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
-	request, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+// fetchResult holds the result of fetching a feed. If the feed has not changed since it
+// was last fetched, NotModified is set and Feed is nil.
+type fetchResult struct {
+	Feed         *RSSFeed
+	NotModified  bool
+	ETag         string
+	LastModified string
+	// MovedTo is the URL the feed has permanently moved to, if it was fetched through
+	// one or more permanent (301 or 308) redirects.
+	MovedTo string
+	// Fresh is how long the server says the feed will remain unchanged for.
+	Fresh time.Duration
+}
+
+// statusError is returned when a request fails with an unexpected HTTP status.
+type statusError struct {
+	StatusCode int
+	// RetryAfter is how long the server asks to wait before trying again, if it is
+	// overloaded (503) or rate limiting (429).
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// fetchFeed fetches the feed from the provided URL and creates a new RSSFeed object.
+// RSS (0.9x, 1.0 and 2.0), Atom and JSON feeds are supported.
+//
+// The etag and lastModified values from a previous fetch, if present, are sent as
+// If-None-Match and If-Modified-Since headers so that an unchanged feed is not
+// downloaded again.
+//
+// Redirects are followed, and if the chain of redirects begins with permanent redirects
+// the last permanent location is returned in the result so the feed can be updated.
+//
+// The Cache-Control or Expires headers of the response are returned as the time the feed
+// remains fresh, and the Retry-After header of a 429 or 503 response is returned in the
+// error.
+func fetchFeed(ctx context.Context, client *httpClient, feedURL, etag, lastModified string) (*fetchResult, error) {
+	request, err := client.newRequest(ctx, feedURL)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("User-Agent", "Gator")
-	httpClient := &http.Client{}
-	response, err := httpClient.Do(request)
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		request.Header.Set("If-Modified-Since", lastModified)
+	}
+	movedTo := ""
+	permanent := true
+	redirectClient := *client.Client
+	redirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		status := req.Response.StatusCode
+		permanent = permanent && (status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect)
+		if permanent {
+			movedTo = req.URL.String()
+		}
+		return nil
+	}
+	response, err := redirectClient.Do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer response.Body.Close()
+	now := time.Now()
+	if response.StatusCode == http.StatusNotModified {
+		return &fetchResult{
+			NotModified:  true,
+			ETag:         etag,
+			LastModified: lastModified,
+			MovedTo:      movedTo,
+			Fresh:        freshness(response.Header, now),
+		}, nil
+	}
 	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code %d", response.StatusCode)
+		err := &statusError{StatusCode: response.StatusCode}
+		if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+			err.RetryAfter = retryAfter(response.Header, now)
+		}
+		return nil, err
 	}
-	feed := &RSSFeed{}
-	data, err := io.ReadAll(response.Body)
+	data, err := client.readBody(response)
 	if err != nil {
 		return nil, err
 	}
-	err = xml.Unmarshal(data, feed)
+	feed, err := parseFeed(data, response.Header.Get("Content-Type"))
 	if err != nil {
 		return nil, err
 	}
-	feed.Channel.Title = html.UnescapeString(feed.Channel.Title)
-	feed.Channel.Description = html.UnescapeString(feed.Channel.Description)
-	for _, item := range feed.Channel.Item {
-		item.Title = html.UnescapeString(item.Title)
-		item.Description = html.UnescapeString(item.Description)
-	}
-	return feed, nil
+	return &fetchResult{
+		Feed:         feed,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		MovedTo:      movedTo,
+		Fresh:        freshness(response.Header, now),
+	}, nil
 }
 
 // getUser is a filter function which takes a slice of users and an ID, and returns
@@ -59,42 +125,173 @@ func getUser(users []database.User, id uuid.UUID) (*database.User, error) {
 	return nil, errors.New("user not found")
 }
 
-func scrapeFeeds(s *state) error {
-	nextFeed, err := s.db.GetNextFeedToFetch(context.Background())
+// getPost returns the post identified by ref, which is either the URL of the post or its ID.
+func getPost(ctx context.Context, s *state, ref string) (database.Post, error) {
+	id, err := uuid.Parse(ref)
+	if err == nil {
+		return s.db.GetPost(ctx, id)
+	}
+	return s.db.GetPostByURL(ctx, ref)
+}
+
+// scrapeFeed fetches the feed and stores its new and changed posts, then schedules its
+// next fetch. The fetch is recorded as made by worker. The ETag and Last-Modified of the
+// response are only stored once every post has been, so that a fetch that is cancelled or
+// fails to store a post is repeated in full. Returns the number of posts stored.
+func scrapeFeed(ctx context.Context, s *state, nextFeed database.Feed, worker string) (int, error) {
+	result, err := fetchFeed(ctx, s.client, nextFeed.Url, nextFeed.Etag.String, nextFeed.LastModified.String)
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			// the fetch was cancelled, which says nothing about the feed
+			return 0, err
+		}
+		return 0, errors.Join(err, markFeedFailed(ctx, s, nextFeed, worker, err))
 	}
 
-	nextFeed, err = s.db.MarkFeedFetched(context.Background(), nextFeed.ID)
+	if result.MovedTo != "" && result.MovedTo != nextFeed.Url {
+		migrated, err := migrateFeed(ctx, s, nextFeed, result.MovedTo)
+		if err != nil {
+			return 0, err
+		}
+		if migrated.ID != nextFeed.ID {
+			// the feed was merged into an existing feed, which is not leased to this worker
+			// and is fetched in its own time
+			return 0, nil
+		}
+		nextFeed = migrated
+	}
+
+	status := http.StatusOK
+	if result.NotModified {
+		status = http.StatusNotModified
+	}
+	nextFeed, err = s.db.MarkFeedFetched(ctx, database.MarkFeedFetchedParams{
+		ID:            nextFeed.ID,
+		LastStatus:    sql.NullInt32{Int32: int32(status), Valid: true},
+		LastFetchedBy: nullString(worker),
+		LeasedBy:      nextFeed.LeasedBy,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errLeaseLost
+	}
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if result.NotModified {
+		fmt.Printf("No changes to %s\n", nextFeed.Name)
+		return 0, scheduleFeed(ctx, s, nextFeed, false, result.Fresh)
 	}
 
-	feed, err := fetchFeed(context.Background(), nextFeed.Url)
+	feed := result.Feed
+	hints := feed.updateHintsParams(nextFeed.ID)
+	hints.LeasedBy = nextFeed.LeasedBy
+	hinted, err := s.db.SetFeedUpdateHints(ctx, hints)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errLeaseLost
+	}
 	if err != nil {
-		return err
+		fmt.Println("Error storing update hints:", err)
+	} else {
+		nextFeed = hinted
 	}
 
+	// posts stored before the feed gave them guids have fallback guids, which are replaced
+	// by the guids the feed now gives them
+	fallbackGUIDs := make(map[string]bool)
+	if feed.hasGUIDs() {
+		guids, err := s.db.GetFallbackGUIDs(ctx, nextFeed.ID)
+		if err != nil {
+			fmt.Println("Error getting fallback guids:", err)
+		}
+		for _, guid := range guids {
+			fallbackGUIDs[guid] = true
+		}
+	}
+
+	stored := 0
+	complete := true
+
 	fmt.Printf("Latest articles from %s\n", feed.Channel.Title)
 	for _, item := range feed.Channel.Item {
-		// TODO: Handle additional formats for publishedAt
-		publishedAt, _ := time.Parse(time.RFC3339, item.PubDate)
-		params := database.CreatePostParams{
+		if ctx.Err() != nil {
+			return stored, ctx.Err()
+		}
+		publishedAt := item.publishedAt()
+		if !publishedAt.Valid && (item.PubDate != "" || item.DCDate != "") {
+			fmt.Printf("Unrecognised publication date for %q (pubDate %q, dc:date %q), storing without a date\n",
+				item.Title, item.PubDate, item.DCDate)
+		}
+		guid := item.guid()
+		if guid != item.fallbackGUID() && fallbackGUIDs[item.fallbackGUID()] {
+			err = s.db.AdoptPostGUID(ctx, database.AdoptPostGUIDParams{
+				Guid:         guid,
+				FeedID:       nextFeed.ID,
+				FallbackGuid: item.fallbackGUID(),
+			})
+			if err != nil {
+				fmt.Println("Error adopting post guid:", err)
+			}
+		}
+		params := database.UpsertPostParams{
 			ID:          uuid.New(),
 			Title:       item.Title,
 			Url:         item.Link,
 			Description: sql.NullString{String: item.Description, Valid: true},
-			PublishedAt: sql.NullTime{Time: publishedAt, Valid: true},
+			PublishedAt: publishedAt,
 			FeedID:      nextFeed.ID,
+			Author:      nullString(item.author()),
+			Content:     nullString(item.Content),
+			Guid:        guid,
+			RevisionID:  uuid.New(),
+		}
+		params.ContentHash = contentHash(params.Title, params.Url, params.Author, params.Description, params.Content)
+		post, err := s.db.UpsertPost(ctx, params)
+		changed := true
+		if errors.Is(err, sql.ErrNoRows) {
+			// the post has already been stored and has not changed, or has only been filled in,
+			// but may have been stored before its tags and enclosures were
+			changed = false
+			post.ID, err = s.db.GetPostIDByGUID(ctx, database.GetPostIDByGUIDParams{FeedID: nextFeed.ID, Guid: guid})
+		}
+		if err != nil {
+			fmt.Println("Error storing post:", err)
+			complete = false
+			continue
+		}
+		if changed {
+			stored++
 		}
-		_, err := s.db.CreatePost(context.Background(), params)
+		err = storeTags(ctx, s, post.ID, item.tags())
 		if err != nil {
-			// ignore duplicate urls
-			if err.Error() == "pq: duplicate key value violates unique constraint \"posts_url_key\"" {
-				continue
+			fmt.Println("Error storing tags:", err)
+		}
+		for _, enclosure := range item.enclosureParams(post.ID) {
+			err = s.db.CreateEnclosure(ctx, enclosure)
+			if err != nil {
+				fmt.Println("Error creating enclosure:", err)
 			}
-			fmt.Println("Error creating post:", err)
+		}
+		if changed && nextFeed.FetchFullArticle && post.Url != "" {
+			err = storeArticle(ctx, s, post)
+			if err != nil {
+				fmt.Printf("Error fetching full article for %q: %v\n", post.Title, err)
+			}
+		}
+	}
+
+	// the feed is only conditionally fetched once all of its posts have been stored, so that
+	// any that were not are fetched again
+	if complete {
+		err = s.db.SetFeedCacheValidators(ctx, database.SetFeedCacheValidatorsParams{
+			ID:           nextFeed.ID,
+			Etag:         sql.NullString{String: result.ETag, Valid: result.ETag != ""},
+			LastModified: sql.NullString{String: result.LastModified, Valid: result.LastModified != ""},
+			LeasedBy:     nextFeed.LeasedBy,
+		})
+		if err != nil {
+			fmt.Println("Error storing cache validators:", err)
 		}
 	}
-	return nil
+	return stored, scheduleFeed(ctx, s, nextFeed, stored > 0, result.Fresh)
 }